@@ -0,0 +1,83 @@
+package httptesting
+
+import (
+	"errors"
+	"strings"
+)
+
+// Count is a count(column) select expression, count(*) for an empty column or "*". An empty alias is left out
+func Count(column string, alias string) string {
+	if len(column) == 0 {
+		column = "*"
+	}
+	return aggregate("count", column, alias)
+}
+
+func Sum(column string, alias string) string {
+	return aggregate("sum", column, alias)
+}
+
+func Avg(column string, alias string) string {
+	return aggregate("avg", column, alias)
+}
+
+func Min(column string, alias string) string {
+	return aggregate("min", column, alias)
+}
+
+func Max(column string, alias string) string {
+	return aggregate("max", column, alias)
+}
+
+func aggregate(function string, column string, alias string) string {
+	expression := function + "(" + strings.TrimSpace(column) + ")"
+	if alias = strings.TrimSpace(alias); len(alias) > 0 {
+		expression = expression + " AS " + alias
+	}
+	return expression
+}
+
+// returnedName is the column name a select expression comes back as, the alias of an aggregate if it has one
+func returnedName(name string) string {
+	if !expressionPattern.MatchString(name) {
+		return name
+	}
+	if index := strings.LastIndex(name, " AS "); index >= 0 {
+		return name[index+len(" AS "):]
+	}
+	return name
+}
+
+func (s *SqlBuilder) GroupBy(columns ...string) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of GroupBy is not appropriate")
+		return s
+	}
+	s.groupByParams = append(s.groupByParams, columns...)
+	return s
+}
+
+// Having filters groups, e.g. Having(Cond(Count("", ""), ">", 5)), arguments are bound after the ones of the WHERE clause
+func (s *SqlBuilder) Having(conditions ...Condition) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of Having is not appropriate")
+		return s
+	}
+	s.havingConditions = append(s.havingConditions, conditions...)
+	return s
+}
+
+func buildGroupByClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+	if len(s.groupByParams) > 0 {
+		columns := make([]string, 0, len(s.groupByParams))
+		for _, column := range s.groupByParams {
+			columns = append(columns, s.identifier(column))
+		}
+		sb.Write(" GROUP BY ", strings.Join(columns, ", "))
+	}
+	if len(s.havingConditions) > 0 {
+		sb.Write(" HAVING ", renderConditions(s, s.havingConditions))
+	}
+	return sb.String()
+}
@@ -0,0 +1,180 @@
+package httptesting
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Statement is a built statement with its arguments and returned columns
+type Statement struct {
+	Query     string
+	Args      []interface{}
+	Returning []string
+}
+
+// RowSource hands out rows one at a time, ok is false once there are no more rows
+type RowSource func() (row []interface{}, ok bool)
+
+func RowsOf(rows [][]interface{}) RowSource {
+	index := 0
+	return func() ([]interface{}, bool) {
+		if index >= len(rows) {
+			return nil, false
+		}
+		index++
+		return rows[index-1], true
+	}
+}
+
+// InsertMany inserts several rows with a single multi-row VALUES statement. Use BuildBatches when
+// the rows may need more arguments than the database takes in one statement
+func (s *SqlBuilder) InsertMany(tableName string, columns []string, rows [][]interface{}) *SqlBuilder {
+	s.Insert(tableName)
+	s.manyColumns = columns
+	s.manyRows = rows
+
+	if len(columns) == 0 {
+		s.err = errors.New("No insertion columns passed")
+	}
+	return s
+}
+
+func buildManyValuesClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if len(s.manyRows) == 0 {
+		s.err = errors.New("No insertion rows passed")
+	}
+
+	columns := make([]string, 0, len(s.manyColumns))
+	for _, column := range s.manyColumns {
+		columns = append(columns, s.identifier(column))
+	}
+	sb.Write("(", strings.Join(columns, ", "), ") VALUES ")
+
+	for i, row := range s.manyRows {
+		if len(row) != len(s.manyColumns) {
+			s.err = errors.New("Every row has to have a value for each column")
+			continue
+		}
+		if i > 0 {
+			sb.Write(", ")
+		}
+		placeholders := make([]string, 0, len(row))
+		for j, value := range row {
+			placeholders = append(placeholders, s.bind(s.manyColumns[j], value))
+		}
+		sb.Write("(", strings.Join(placeholders, ", "), ")")
+	}
+	return sb.String()
+}
+
+func (s *SqlBuilder) reservedArguments() int {
+	probe := s.Clone()
+	probe.manyRows = nil
+	probe.statement()
+	return len(probe.argumentValues)
+}
+
+func (s *SqlBuilder) batchSize() int {
+	if len(s.manyColumns) == 0 {
+		return 1
+	}
+	size := (s.Dialect().MaxPlaceholders() - s.reservedArguments()) / len(s.manyColumns)
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// BuildBatches splits an InsertMany into statements staying under the argument limit of the dialect
+func (s *SqlBuilder) BuildBatches() ([]Statement, error) {
+	if !s.insertFlag || s.manyColumns == nil {
+		return nil, errors.New("BuildBatches is only supported for InsertMany")
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.manyRows) == 0 {
+		return nil, errors.New("No insertion rows passed")
+	}
+
+	statements := make([]Statement, 0)
+	size := s.batchSize()
+	for start := 0; start < len(s.manyRows); start += size {
+		end := start + size
+		if end > len(s.manyRows) {
+			end = len(s.manyRows)
+		}
+
+		batch := s.Clone()
+		batch.manyRows = s.manyRows[start:end]
+		query, inArgs, outArgs, err := batch.Build()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, Statement{Query: query, Args: inArgs, Returning: outArgs})
+	}
+	return statements, nil
+}
+
+// BulkInsert streams rows into the table of an InsertMany, in multi-row statements as large as the dialect allows.
+// Conflict handling, quoting and safe mode of the builder apply to every statement, rows passed to InsertMany
+// are replaced by the ones of the source. Returns the sum of the affected rows reported by the driver, which only
+// counts inserted rows on Postgres and SQLite: MySQL counts updated duplicates twice, and its DoNothing duplicates
+// depending on the clientFoundRows setting of the connection
+//
+//	inserted, err := sb.InsertMany("events", []string{"id", "kind"}, nil).OnConflict("id").DoNothing().BulkInsert(tx, RowsOf(rows))
+func (s *SqlBuilder) BulkInsert(db SqlExecutor, rows RowSource) (int64, error) {
+	if !s.insertFlag || s.manyColumns == nil {
+		return 0, errors.New("BulkInsert is only supported for InsertMany")
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	if len(s.returningParams) > 0 {
+		return 0, errors.New("BulkInsert does not read returned rows, use BuildBatches")
+	}
+
+	var inserted int64
+	size := s.batchSize()
+	batch := make([][]interface{}, 0, size)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		builder := s.Clone()
+		builder.manyRows = batch
+		query, inArgs, _, err := builder.Build()
+		if err != nil {
+			return err
+		}
+		var result sql.Result
+		if result, err = db.Exec(query, inArgs...); err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			inserted += affected
+		} else {
+			inserted += int64(len(batch))
+		}
+		batch = make([][]interface{}, 0, size)
+		return nil
+	}
+
+	for {
+		row, ok := rows()
+		if !ok {
+			break
+		}
+		batch = append(batch, row)
+		if len(batch) >= size {
+			if err := flush(); err != nil {
+				return inserted, err
+			}
+		}
+	}
+	return inserted, flush()
+}
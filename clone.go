@@ -0,0 +1,78 @@
+package httptesting
+
+import (
+	"github.com/elliotchance/orderedmap"
+)
+
+// Clone copies a builder, so a base query can be extended per call site without affecting the original:
+//
+//	tenantUsers := httptesting.PostgresSqlBuilder{}
+//	tenantUsers.Select("users").Returning("id", "name").WhereArg("tenantid", tenantId)
+//	query, inArgs, _, err := tenantUsers.Clone().WhereArg("active", true).Build()
+//
+// CTEs, unions and FROM subqueries are cloned as well. Conditions, including builders used in Exists or In, are shared,
+// building reads them without writing, so clones can be built concurrently
+func (s *SqlBuilder) Clone() *SqlBuilder {
+	clone := *s
+	clone.parent = nil
+	clone.source = nil
+	clone.buffer = StringBuilder{}
+	clone.argumentNames = nil
+	clone.argumentValues = nil
+
+	clone.setParams = copyOrderedMap(s.setParams)
+	clone.setExplicitParams = copyOrderedMap(s.setExplicitParams)
+	clone.whereParams = copyOrderedMap(s.whereParams)
+	clone.whereParamsRelationship = copyOrderedMap(s.whereParamsRelationship)
+	clone.orderByParams = copyOrderedMap(s.orderByParams)
+
+	clone.whereConditions = append([]Condition(nil), s.whereConditions...)
+	clone.havingConditions = append([]Condition(nil), s.havingConditions...)
+	clone.groupByParams = append([]string(nil), s.groupByParams...)
+	clone.returningParams = append([]string(nil), s.returningParams...)
+	if s.manyColumns != nil {
+		clone.manyColumns = append([]string(nil), s.manyColumns...)
+		clone.manyRows = append([][]interface{}(nil), s.manyRows...)
+	}
+
+	clone.joins = make([]*joinClause, 0, len(s.joins))
+	for _, join := range s.joins {
+		copied := *join
+		copied.on = append([]Condition(nil), join.on...)
+		clone.joins = append(clone.joins, &copied)
+	}
+
+	if s.onConflict != nil {
+		conflict := *s.onConflict
+		conflict.columns = append([]string(nil), s.onConflict.columns...)
+		conflict.where = append([]Condition(nil), s.onConflict.where...)
+		conflict.updateWhere = append([]Condition(nil), s.onConflict.updateWhere...)
+		conflict.setParams = copyOrderedMap(s.onConflict.setParams)
+		clone.onConflict = &conflict
+	}
+
+	clone.withQueries = make([]commonTableExpression, 0, len(s.withQueries))
+	for _, cte := range s.withQueries {
+		clone.withQueries = append(clone.withQueries, commonTableExpression{name: cte.name, query: cte.query.Clone()})
+	}
+	clone.unions = make([]union, 0, len(s.unions))
+	for _, u := range s.unions {
+		clone.unions = append(clone.unions, union{all: u.all, query: u.query.Clone()})
+	}
+	if s.fromSubquery != nil {
+		clone.fromSubquery = s.fromSubquery.Clone()
+	}
+	return &clone
+}
+
+func copyOrderedMap(m *orderedmap.OrderedMap) *orderedmap.OrderedMap {
+	if m == nil {
+		return nil
+	}
+	copied := orderedmap.NewOrderedMap()
+	for _, key := range m.Keys() {
+		value, _ := m.Get(key)
+		copied.Set(key, value)
+	}
+	return copied
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+
+	"github.com/shoorikl/httptesting"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func newJunitSuite(name string, results []httptesting.StepResult) junitSuite {
+	suite := junitSuite{Name: name, Tests: len(results)}
+	for _, result := range results {
+		testCase := junitCase{Name: stepName(result.Step), Classname: name, Time: result.Duration.Seconds()}
+		if result.Err != nil {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: result.Err.Error(),
+				Text:    result.Step.Method + " " + result.Step.Path + "\n" + result.Exchange.ResponseBody,
+			}
+		}
+		suite.Time += testCase.Time
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	return suite
+}
+
+func newJunitLoadFailure(fileName string, err error) junitSuite {
+	return junitSuite{Name: fileName, Tests: 1, Failures: 1, Cases: []junitCase{{
+		Name:      "load",
+		Classname: fileName,
+		Failure:   &junitFailure{Message: err.Error(), Text: err.Error()},
+	}}}
+}
+
+func writeJunit(fileName string, suites []junitSuite) error {
+	content, err := xml.MarshalIndent(junitSuites{Suites: suites}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append([]byte(xml.Header), content...), 0644)
+}
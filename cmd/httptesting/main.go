@@ -0,0 +1,226 @@
+// Command httptesting runs .http and scenario files against deployed services,
+// converts .http files and recordings to other formats and compares recordings.
+//
+//	httptesting run -base-url https://api.example.com [-junit report.xml] [-record out.json] smoke.http checkout.yaml
+//	httptesting convert -to postman|har|openapi [-base-url URL] [-o out.json] chitchat.http
+//	httptesting diff expected.json actual.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shoorikl/httptesting"
+)
+
+const (
+	exitOk      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	var code int
+	switch os.Args[1] {
+	case "run":
+		code = run(os.Args[2:])
+	case "convert":
+		code = convert(os.Args[2:])
+	case "diff":
+		code = diff(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		usage()
+		code = exitOk
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+		usage()
+		code = exitUsage
+	}
+	os.Exit(code)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: httptesting <command> [flags] files...
+
+Commands:
+  run      execute .http or scenario (.json, .yaml) files against a base url
+  convert  convert a .http file or a recording to postman, har or openapi
+  diff     compare two recordings, exits with 1 if they differ
+`)
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	baseUrl := flags.String("base-url", "", "base url of the service under test, overrides @baseUrl")
+	junit := flags.String("junit", "", "write a JUnit xml report to this file")
+	record := flags.String("record", "", "write a recording of all exchanges to this file")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of a single request")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "No files to run\n")
+		return exitUsage
+	}
+
+	runner := httptesting.NewRunner(*baseUrl)
+	runner.Client.Timeout = *timeout
+
+	suites := make([]junitSuite, 0)
+	failed := false
+	for _, fileName := range flags.Args() {
+		scenario, err := httptesting.LoadScenario(fileName)
+		if err != nil {
+			// The other files still run, the report shows the file as a failed suite
+			failed = true
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			suites = append(suites, newJunitLoadFailure(fileName, err))
+			continue
+		}
+
+		fmt.Printf("%s\n", scenario.Name)
+		results := runner.Run(scenario)
+		for _, result := range results {
+			if result.Err != nil {
+				failed = true
+				fmt.Printf("  FAIL %s (%s): %s\n", stepName(result.Step), result.Duration, result.Err.Error())
+			} else {
+				fmt.Printf("  ok   %s (%s)\n", stepName(result.Step), result.Duration)
+			}
+		}
+		suites = append(suites, newJunitSuite(scenario.Name, results))
+	}
+
+	if len(*junit) > 0 {
+		if err := writeJunit(*junit, suites); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot write %s: %s\n", *junit, err.Error())
+			return exitFailure
+		}
+	}
+	if len(*record) > 0 {
+		if err := httptesting.SaveRecording(*record, runner.Recording()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot write %s: %s\n", *record, err.Error())
+			return exitFailure
+		}
+	}
+
+	if failed {
+		return exitFailure
+	}
+	return exitOk
+}
+
+func convert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := flags.String("to", "", "target format: postman, har or openapi")
+	baseUrl := flags.String("base-url", "", "base url, overrides @baseUrl")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Exactly one .http file or recording has to be specified\n")
+		return exitUsage
+	}
+
+	fileName := flags.Arg(0)
+	rec, err := loadRecording(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitUsage
+	}
+	if len(*baseUrl) > 0 {
+		rec.BaseUrl = *baseUrl
+	}
+
+	title := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	var content []byte
+	switch strings.ToLower(*to) {
+	case "postman":
+		content, err = httptesting.ToPostman(title, rec)
+	case "har":
+		content, err = httptesting.ToHar(rec)
+	case "openapi":
+		content, err = httptesting.ToOpenApi(title, rec)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format: %q, should be one of postman, har, openapi\n", *to)
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitFailure
+	}
+
+	if len(*output) == 0 {
+		fmt.Println(string(content))
+		return exitOk
+	}
+	if err := ioutil.WriteFile(*output, content, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot write %s: %s\n", *output, err.Error())
+		return exitFailure
+	}
+	return exitOk
+}
+
+func diff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Two recordings have to be specified\n")
+		return exitUsage
+	}
+
+	expected, err := loadRecording(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitUsage
+	}
+	actual, err := loadRecording(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitUsage
+	}
+
+	differences := httptesting.DiffRecordings(expected, actual)
+	for _, d := range differences {
+		fmt.Println(d)
+	}
+	if len(differences) > 0 {
+		return exitFailure
+	}
+	return exitOk
+}
+
+func loadRecording(fileName string) (*httptesting.Recording, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".http", ".rest":
+		httpFile, err := httptesting.LoadHttpFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return httpFile.Recording(), nil
+	}
+	return httptesting.LoadRecording(fileName)
+}
+
+func stepName(step httptesting.ScenarioStep) string {
+	if len(step.Description) > 0 {
+		return step.Description
+	}
+	if len(step.Name) > 0 {
+		return step.Name
+	}
+	return step.Method + " " + step.Path
+}
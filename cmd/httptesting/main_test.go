@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "httptesting")
+	if err != nil {
+		t.Fatalf("Cannot create directory: %s", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Cannot write %s: %s", name, err.Error())
+		}
+	}
+	return dir
+}
+
+func testService() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if req.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Status": "Broken"}`))
+			return
+		}
+		w.Write([]byte(`{"Status": "OK"}`))
+	}))
+}
+
+func readJunit(t *testing.T, fileName string) junitSuites {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Cannot read report: %s", err.Error())
+	}
+	report := junitSuites{}
+	if err := xml.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Cannot parse report: %s", err.Error())
+	}
+	return report
+}
+
+func TestRun(t *testing.T) {
+	server := testService()
+	defer server.Close()
+
+	dir := testDir(t, map[string]string{
+		"ok.http":      "# Status\nGET {{baseUrl}}/status\n",
+		"broken.http":  "# Status\nGET {{baseUrl}}/status\n\n###\n# Broken\nGET {{baseUrl}}/broken\n",
+		"invalid.yaml": "steps: [",
+	})
+	report := filepath.Join(dir, "report.xml")
+	record := filepath.Join(dir, "recording.json")
+
+	if code := run([]string{"-base-url", server.URL, "-junit", report, "-record", record, filepath.Join(dir, "ok.http")}); code != exitOk {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if suites := readJunit(t, report).Suites; len(suites) != 1 || suites[0].Name != "ok" || suites[0].Tests != 1 || suites[0].Failures != 0 {
+		t.Errorf("Unexpected report: %v", suites)
+	}
+	if _, err := os.Stat(record); err != nil {
+		t.Errorf("The recording should be written: %s", err.Error())
+	}
+
+	if code := run([]string{"-base-url", server.URL, "-junit", report, filepath.Join(dir, "broken.http")}); code != exitFailure {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	suites := readJunit(t, report).Suites
+	if len(suites) != 1 || suites[0].Tests != 2 || suites[0].Failures != 1 || suites[0].Cases[1].Name != "Broken" || suites[0].Cases[1].Failure == nil {
+		t.Errorf("Unexpected report: %v", suites)
+	}
+
+	// Files which can't be loaded fail their own suite only
+	files := []string{filepath.Join(dir, "invalid.yaml"), filepath.Join(dir, "missing.http"), filepath.Join(dir, "ok.http")}
+	if code := run(append([]string{"-base-url", server.URL, "-junit", report}, files...)); code != exitFailure {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	suites = readJunit(t, report).Suites
+	if len(suites) != 3 || suites[0].Failures != 1 || suites[0].Cases[0].Failure == nil || suites[1].Failures != 1 || suites[2].Name != "ok" || suites[2].Failures != 0 {
+		t.Errorf("Load errors should be reported as failed suites: %v", suites)
+	}
+
+	if code := run([]string{"-base-url", server.URL}); code != exitUsage {
+		t.Errorf("Running without files is a usage error: %d", code)
+	}
+	if code := run([]string{"-unknown"}); code != exitUsage {
+		t.Errorf("Unknown flags are a usage error: %d", code)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := testDir(t, map[string]string{"api.http": "@baseUrl = https://www.example.com\n\n###\n# Status\nGET {{baseUrl}}/status\n"})
+	output := filepath.Join(dir, "api.json")
+
+	for _, format := range []string{"postman", "har", "openapi"} {
+		if code := convert([]string{"-to", format, "-o", output, filepath.Join(dir, "api.http")}); code != exitOk {
+			t.Errorf("Unexpected exit code converting to %s: %d", format, code)
+		}
+		if content, err := ioutil.ReadFile(output); err != nil || !strings.Contains(string(content), "/status") {
+			t.Errorf("Unexpected %s output: %s %v", format, string(content), err)
+		}
+	}
+
+	if code := convert([]string{"-to", "curl", filepath.Join(dir, "api.http")}); code != exitUsage {
+		t.Errorf("Unknown formats are a usage error: %d", code)
+	}
+	if code := convert([]string{"-to", "har", filepath.Join(dir, "missing.http")}); code != exitUsage {
+		t.Errorf("Missing files are a usage error: %d", code)
+	}
+	if code := convert([]string{"-to", "har"}); code != exitUsage {
+		t.Errorf("Converting without a file is a usage error: %d", code)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"expected.http": "# Status\nGET https://www.example.com/status\n",
+		"same.http":     "# Status\nGET https://www.example.com/status\n",
+		"changed.http":  "# Status\nGET https://www.example.com/health\n",
+	})
+
+	if code := diff([]string{filepath.Join(dir, "expected.http"), filepath.Join(dir, "same.http")}); code != exitOk {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if code := diff([]string{filepath.Join(dir, "expected.http"), filepath.Join(dir, "changed.http")}); code != exitFailure {
+		t.Errorf("Differences should fail: %d", code)
+	}
+	if code := diff([]string{filepath.Join(dir, "expected.http"), filepath.Join(dir, "missing.json")}); code != exitUsage {
+		t.Errorf("Missing files are a usage error: %d", code)
+	}
+	if code := diff([]string{filepath.Join(dir, "expected.http")}); code != exitUsage {
+		t.Errorf("Diff needs two recordings: %d", code)
+	}
+}
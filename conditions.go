@@ -0,0 +1,231 @@
+package httptesting
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Condition is a predicate of a WHERE clause, arguments are bound when the statement is built
+type Condition interface {
+	render(s *SqlBuilder) string
+}
+
+type comparison struct {
+	column       string
+	relationship string
+	value        interface{}
+}
+
+type conditionGroup struct {
+	operator   string
+	conditions []Condition
+}
+
+type negation struct {
+	condition Condition
+}
+
+// Cond compares a column with a value, e.g. Cond("created", ">=", since)
+func Cond(column string, relationship string, value interface{}) Condition {
+	return &comparison{column: column, relationship: strings.TrimSpace(relationship), value: value}
+}
+
+func Equal(column string, value interface{}) Condition {
+	return Cond(column, "=", value)
+}
+
+// And matches when all conditions do, the group is parenthesised
+func And(conditions ...Condition) Condition {
+	return &conditionGroup{operator: "AND", conditions: conditions}
+}
+
+// Or matches when any of the conditions does, the group is parenthesised
+func Or(conditions ...Condition) Condition {
+	return &conditionGroup{operator: "OR", conditions: conditions}
+}
+
+func Not(condition Condition) Condition {
+	return &negation{condition: condition}
+}
+
+func (c *comparison) render(s *SqlBuilder) string {
+	return s.compare(s.identifier(c.column), c.relationship, s.bind(c.column, c.value))
+}
+
+func (g *conditionGroup) render(s *SqlBuilder) string {
+	if len(g.conditions) == 0 {
+		// Nothing to satisfy for AND, nothing can be satisfied for OR
+		if g.operator == "OR" {
+			return "1=0"
+		}
+		return "1=1"
+	}
+	if len(g.conditions) == 1 {
+		return g.conditions[0].render(s)
+	}
+
+	parts := make([]string, 0, len(g.conditions))
+	for _, condition := range g.conditions {
+		parts = append(parts, condition.render(s))
+	}
+	return "(" + strings.Join(parts, " "+g.operator+" ") + ")"
+}
+
+func (n *negation) render(s *SqlBuilder) string {
+	return "NOT (" + n.condition.render(s) + ")"
+}
+
+type inList struct {
+	column string
+	values interface{}
+	not    bool
+}
+
+type anyOf struct {
+	column string
+	values interface{}
+}
+
+type nullCheck struct {
+	column string
+	not    bool
+}
+
+type between struct {
+	column string
+	low    interface{}
+	high   interface{}
+}
+
+type like struct {
+	column          string
+	pattern         string
+	caseInsensitive bool
+}
+
+// In matches columns equal to any element of a slice, each element is bound on its own: id IN ($1, $2, $3).
+// Values may also be a select builder, rendered as a subquery
+func In(column string, values interface{}) Condition {
+	return &inList{column: column, values: values}
+}
+
+func NotIn(column string, values interface{}) Condition {
+	return &inList{column: column, values: values, not: true}
+}
+
+// AnyOf binds a whole slice as one Postgres array argument: id = ANY($1). Drivers like lib/pq need the slice wrapped, e.g. pq.Array(ids)
+func AnyOf(column string, values interface{}) Condition {
+	return &anyOf{column: column, values: values}
+}
+
+func IsNull(column string) Condition {
+	return &nullCheck{column: column}
+}
+
+func IsNotNull(column string) Condition {
+	return &nullCheck{column: column, not: true}
+}
+
+// Between matches columns within an inclusive range
+func Between(column string, low interface{}, high interface{}) Condition {
+	return &between{column: column, low: low, high: high}
+}
+
+// Like matches a pattern, user input should go through LikeEscape or ContainsPattern first
+func Like(column string, pattern string) Condition {
+	return &like{column: column, pattern: pattern}
+}
+
+// ILike matches a pattern regardless of case, dialects without ILIKE compare lower cased values
+func ILike(column string, pattern string) Condition {
+	return &like{column: column, pattern: pattern, caseInsensitive: true}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikeEscape escapes the wildcards of LIKE patterns, so a string is matched literally
+func LikeEscape(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func ContainsPattern(s string) string {
+	return "%" + LikeEscape(s) + "%"
+}
+
+func PrefixPattern(s string) string {
+	return LikeEscape(s) + "%"
+}
+
+func SuffixPattern(s string) string {
+	return "%" + LikeEscape(s)
+}
+
+func (c *inList) render(s *SqlBuilder) string {
+	operator := " IN ("
+	if c.not {
+		operator = " NOT IN ("
+	}
+	if query, ok := c.values.(*SqlBuilder); ok {
+		return s.identifier(c.column) + operator + s.subquery(query) + ")"
+	}
+
+	values := reflect.ValueOf(c.values)
+	if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+		s.err = errors.New("IN takes a slice of values")
+		return ""
+	}
+	if values.Len() == 0 {
+		// Nothing is in an empty list
+		if c.not {
+			return "1=1"
+		}
+		return "1=0"
+	}
+
+	placeholders := make([]string, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		placeholders = append(placeholders, s.bind(c.column, values.Index(i).Interface()))
+	}
+	return s.identifier(c.column) + operator + strings.Join(placeholders, ", ") + ")"
+}
+
+func (c *anyOf) render(s *SqlBuilder) string {
+	if s.Dialect() != Postgres {
+		s.err = errors.New("ANY is not supported by " + s.Dialect().Name() + ", use In")
+	}
+	return s.identifier(c.column) + " = ANY(" + s.bind(c.column, c.values) + ")"
+}
+
+func (c *nullCheck) render(s *SqlBuilder) string {
+	if c.not {
+		return s.identifier(c.column) + " IS NOT NULL"
+	}
+	return s.identifier(c.column) + " IS NULL"
+}
+
+func (c *between) render(s *SqlBuilder) string {
+	low := s.bind(c.column, c.low)
+	high := s.bind(c.column, c.high)
+	return s.identifier(c.column) + " BETWEEN " + low + " AND " + high
+}
+
+func (c *like) render(s *SqlBuilder) string {
+	column := s.identifier(c.column)
+	placeholder := s.bind(c.column, c.pattern)
+
+	var clause string
+	switch {
+	case !c.caseInsensitive:
+		clause = column + " LIKE " + placeholder
+	case s.Dialect() == Postgres:
+		clause = column + " ILIKE " + placeholder
+	default:
+		clause = "LOWER(" + column + ") LIKE LOWER(" + placeholder + ")"
+	}
+	if s.Dialect() == Sqlite {
+		// SQLite has no default escape character
+		clause = clause + ` ESCAPE '\'`
+	}
+	return clause
+}
@@ -0,0 +1,309 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ginParamPattern = regexp.MustCompile(`([:*])([A-Za-z0-9_]+)`)
+
+// ToPostman converts a recording into a Postman v2.1 collection. {{baseUrl}} is kept as a collection variable
+func ToPostman(name string, rec *Recording) ([]byte, error) {
+	items := make([]interface{}, 0)
+	for _, exchange := range rec.Exchanges {
+		request := map[string]interface{}{
+			"method": exchange.Method,
+			"header": postmanHeaders(exchange.RequestHeaders),
+			"url":    map[string]interface{}{"raw": fullUrl("{{baseUrl}}", exchange.Url)},
+		}
+		if len(exchange.RequestBody) > 0 {
+			request["body"] = map[string]interface{}{
+				"mode":    "raw",
+				"raw":     exchange.RequestBody,
+				"options": map[string]interface{}{"raw": map[string]interface{}{"language": "json"}},
+			}
+		}
+
+		item := map[string]interface{}{"name": exchangeTitle(exchange), "request": request}
+		if exchange.Status > 0 {
+			item["response"] = []interface{}{map[string]interface{}{
+				"name":            exchangeTitle(exchange),
+				"originalRequest": request,
+				"code":            exchange.Status,
+				"status":          http.StatusText(exchange.Status),
+				"header":          postmanHeaders(exchange.ResponseHeaders),
+				"body":            exchange.ResponseBody,
+			}}
+		}
+		items = append(items, item)
+	}
+
+	collection := map[string]interface{}{
+		"info": map[string]interface{}{
+			"name":   name,
+			"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		"variable": []interface{}{map[string]interface{}{"key": "baseUrl", "value": rec.BaseUrl}},
+		"item":     items,
+	}
+	return json.MarshalIndent(collection, "", "\t")
+}
+
+// ToHar converts a recording into a HTTP Archive 1.2 document
+func ToHar(rec *Recording) ([]byte, error) {
+	started := time.Now().UTC().Format(time.RFC3339)
+	entries := make([]interface{}, 0)
+	for _, exchange := range rec.Exchanges {
+		request := map[string]interface{}{
+			"method":      exchange.Method,
+			"url":         fullUrl(rec.BaseUrl, exchange.Url),
+			"httpVersion": "HTTP/1.1",
+			"headers":     harHeaders(exchange.RequestHeaders),
+			"queryString": harQueryString(exchange.Url),
+			"cookies":     []interface{}{},
+			"headersSize": -1,
+			"bodySize":    len(exchange.RequestBody),
+		}
+		if len(exchange.RequestBody) > 0 {
+			request["postData"] = map[string]interface{}{"mimeType": headerOrDefault(exchange.RequestHeaders, "application/json"), "text": exchange.RequestBody}
+		}
+
+		response := map[string]interface{}{
+			"status":      exchange.Status,
+			"statusText":  http.StatusText(exchange.Status),
+			"httpVersion": "HTTP/1.1",
+			"headers":     harHeaders(exchange.ResponseHeaders),
+			"cookies":     []interface{}{},
+			"content": map[string]interface{}{
+				"size":     len(exchange.ResponseBody),
+				"mimeType": headerOrDefault(exchange.ResponseHeaders, "text/plain"),
+				"text":     exchange.ResponseBody,
+			},
+			"redirectURL": "",
+			"headersSize": -1,
+			"bodySize":    len(exchange.ResponseBody),
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"startedDateTime": started,
+			"time":            0,
+			"request":         request,
+			"response":        response,
+			"cache":           map[string]interface{}{},
+			"timings":         map[string]interface{}{"send": 0, "wait": 0, "receive": 0},
+			"comment":         exchange.Description,
+		})
+	}
+
+	har := map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]interface{}{"name": "httptesting", "version": "1.0"},
+			"entries": entries,
+		},
+	}
+	return json.MarshalIndent(har, "", "\t")
+}
+
+// ToOpenApi converts a recording into an OpenAPI 3 document, using recorded bodies as examples
+func ToOpenApi(title string, rec *Recording) ([]byte, error) {
+	paths := make(map[string]interface{})
+	for _, exchange := range rec.Exchanges {
+		route := exchange.Route
+		if len(route) == 0 {
+			route = urlPath(exchange.Url)
+		}
+		route = strings.SplitN(route, "?", 2)[0]
+		path := ginParamPattern.ReplaceAllString(route, "{$2}")
+
+		pathItem, ok := paths[path].(map[string]interface{})
+		if !ok {
+			pathItem = make(map[string]interface{})
+			paths[path] = pathItem
+		}
+
+		method := strings.ToLower(exchange.Method)
+		operation, ok := pathItem[method].(map[string]interface{})
+		if !ok {
+			operation = map[string]interface{}{"summary": exchange.Description, "responses": map[string]interface{}{}}
+			if len(exchange.Name) > 0 {
+				operation["operationId"] = exchange.Name
+			}
+			parameters := make([]interface{}, 0)
+			for _, match := range ginParamPattern.FindAllStringSubmatch(route, -1) {
+				parameters = append(parameters, map[string]interface{}{
+					"name": match[2], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+				})
+			}
+			if len(parameters) > 0 {
+				operation["parameters"] = parameters
+			}
+			pathItem[method] = operation
+		}
+
+		if len(exchange.RequestBody) > 0 && operation["requestBody"] == nil {
+			media := openApiMedia(exchange.RequestBody)
+			if len(exchange.RequestSchema) > 0 {
+				media["schema"] = openApiSchemaOfFields(exchange.RequestSchema)
+			}
+			operation["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{"application/json": media},
+			}
+		}
+
+		if exchange.Status > 0 {
+			responses := operation["responses"].(map[string]interface{})
+			status := strconv.Itoa(exchange.Status)
+			if responses[status] == nil {
+				response := map[string]interface{}{"description": http.StatusText(exchange.Status)}
+				if len(exchange.ResponseBody) > 0 {
+					response["content"] = map[string]interface{}{"application/json": openApiMedia(exchange.ResponseBody)}
+				}
+				responses[status] = response
+			}
+		}
+	}
+
+	servers := make([]interface{}, 0)
+	if len(rec.BaseUrl) > 0 {
+		servers = append(servers, map[string]interface{}{"url": rec.BaseUrl})
+	}
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": title, "version": "1.0.0"},
+		"servers": servers,
+		"paths":   paths,
+	}
+	return json.MarshalIndent(document, "", "\t")
+}
+
+func openApiMedia(body string) map[string]interface{} {
+	var example interface{}
+	if err := json.Unmarshal([]byte(body), &example); err != nil {
+		return map[string]interface{}{"schema": map[string]interface{}{"type": "string"}, "example": body}
+	}
+	return map[string]interface{}{"schema": openApiSchemaOf(example), "example": example}
+}
+
+func openApiSchemaOf(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties := make(map[string]interface{})
+		for k, item := range v {
+			properties[k] = openApiSchemaOf(item)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case []interface{}:
+		if len(v) > 0 {
+			return map[string]interface{}{"type": "array", "items": openApiSchemaOf(v[0])}
+		}
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+	case float64:
+		return map[string]interface{}{"type": "number"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case nil:
+		return map[string]interface{}{"nullable": true}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+func isAbsoluteUrl(rawUrl string) bool {
+	return strings.HasPrefix(rawUrl, "http://") || strings.HasPrefix(rawUrl, "https://")
+}
+
+func fullUrl(baseUrl string, rawUrl string) string {
+	if isAbsoluteUrl(rawUrl) {
+		return rawUrl
+	}
+	return strings.TrimSuffix(baseUrl, "/") + rawUrl
+}
+
+func urlOrigin(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+func urlPath(rawUrl string) string {
+	if !isAbsoluteUrl(rawUrl) {
+		return rawUrl
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return parsed.RequestURI()
+}
+
+func exchangeTitle(exchange Exchange) string {
+	if len(exchange.Description) > 0 {
+		return exchange.Description
+	}
+	return exchange.Method + " " + exchange.Url
+}
+
+func sortedHeaderNames(headers http.Header) []string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func postmanHeaders(headers http.Header) []interface{} {
+	result := make([]interface{}, 0)
+	for _, k := range sortedHeaderNames(headers) {
+		for _, v := range headers[k] {
+			result = append(result, map[string]interface{}{"key": k, "value": v})
+		}
+	}
+	return result
+}
+
+func harHeaders(headers http.Header) []interface{} {
+	result := make([]interface{}, 0)
+	for _, k := range sortedHeaderNames(headers) {
+		for _, v := range headers[k] {
+			result = append(result, map[string]interface{}{"name": k, "value": v})
+		}
+	}
+	return result
+}
+
+func harQueryString(rawUrl string) []interface{} {
+	result := make([]interface{}, 0)
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return result
+	}
+	query := parsed.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range query[k] {
+			result = append(result, map[string]interface{}{"name": k, "value": v})
+		}
+	}
+	return result
+}
+
+func headerOrDefault(headers http.Header, defaultContentType string) string {
+	contentType := headers.Get("Content-Type")
+	if len(contentType) == 0 {
+		return defaultContentType
+	}
+	return contentType
+}
@@ -0,0 +1,118 @@
+package httptesting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func selectRows(db SqlExecutor, table string, where map[string]interface{}) ([]map[string]interface{}, error) {
+	builder := PostgresSqlBuilder{}
+	builder.Select(table).Returning("*")
+	if len(where) == 0 {
+		builder.All()
+	}
+	columns := make([]string, 0, len(where))
+	for column := range where {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if where[column] == nil {
+			builder.WhereExpr(IsNull(column))
+		} else {
+			builder.WhereArg(column, where[column])
+		}
+	}
+	return builder.QueryToMap(db, 0)
+}
+
+func describeRows(rows []map[string]interface{}) string {
+	if len(rows) == 0 {
+		return "no rows"
+	}
+	sb := StringBuilder{}
+	for _, row := range rows {
+		columns := make([]string, 0, len(row))
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		values := make([]string, 0, len(columns))
+		for _, column := range columns {
+			values = append(values, fmt.Sprintf("%s=%v", column, columnValue(row[column])))
+		}
+		sb.Write("\n\t", strings.Join(values, ", "))
+	}
+	return sb.String()
+}
+
+// columnValue turns []byte text columns into strings
+func columnValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+func rowMatches(row map[string]interface{}, expectedColumns map[string]interface{}) bool {
+	for column, expected := range expectedColumns {
+		actual, ok := row[column]
+		if !ok || fmt.Sprintf("%v", columnValue(actual)) != fmt.Sprintf("%v", columnValue(expected)) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertRowCount checks the number of rows of a table matching column values
+func AssertRowCount(t testing.TB, db SqlExecutor, table string, where map[string]interface{}, expectedCount int) []map[string]interface{} {
+	t.Helper()
+	rows, err := selectRows(db, table, where)
+	if err != nil {
+		t.Errorf("Unable to query %s: %s\n", table, err.Error())
+		return nil
+	}
+	if len(rows) != expectedCount {
+		t.Errorf("Unexpected number of %s rows matching %v: %d, should be %d, found %s\n", table, where, len(rows), expectedCount, describeRows(rows))
+	}
+	return rows
+}
+
+// AssertRowExists checks at least one row of a table matches column values
+func AssertRowExists(t testing.TB, db SqlExecutor, table string, where map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+	rows, err := selectRows(db, table, where)
+	if err != nil {
+		t.Errorf("Unable to query %s: %s\n", table, err.Error())
+		return nil
+	}
+	if len(rows) == 0 {
+		t.Errorf("No %s row matches %v\n", table, where)
+	}
+	return rows
+}
+
+// AssertNoRow checks no row of a table matches column values
+func AssertNoRow(t testing.TB, db SqlExecutor, table string, where map[string]interface{}) {
+	t.Helper()
+	AssertRowCount(t, db, table, where, 0)
+}
+
+// AssertRow checks a row matching where has the expected column values, e.g. that a POST persisted what it claims
+func AssertRow(t testing.TB, db SqlExecutor, table string, where map[string]interface{}, expectedColumns map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	rows, err := selectRows(db, table, where)
+	if err != nil {
+		t.Errorf("Unable to query %s: %s\n", table, err.Error())
+		return nil
+	}
+	for _, row := range rows {
+		if rowMatches(row, expectedColumns) {
+			return row
+		}
+	}
+	t.Errorf("No %s row matching %v has %v, found %s\n", table, where, expectedColumns, describeRows(rows))
+	return nil
+}
@@ -0,0 +1,239 @@
+package httptesting
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RowChange is a row updated by a request
+type RowChange struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// DatabaseChange lists the rows of a table a request inserted, updated and deleted
+type DatabaseChange struct {
+	Table    string                   `json:"table"`
+	Inserted []map[string]interface{} `json:"inserted,omitempty"`
+	Updated  []RowChange              `json:"updated,omitempty"`
+	Deleted  []map[string]interface{} `json:"deleted,omitempty"`
+}
+
+// WatchedTable is a table whose changes are documented
+type WatchedTable struct {
+	Name string
+	// Columns identifying a row, id when empty. Rows lacking one of them are identified by all of their values
+	Key []string
+	// Restricts the snapshots to the rows requests may change, e.g. Equal("customerid", 5), all rows when empty
+	Where []Condition
+}
+
+var watchedDb SqlExecutor
+var watchedTables []WatchedTable
+
+// DocumentDatabaseChanges snapshots tables before and after every documented request, and documents the
+// rows it inserted, updated and deleted. Rows are matched on their id column. Call it without tables to stop
+func DocumentDatabaseChanges(db SqlExecutor, tables ...string) {
+	watched := make([]WatchedTable, 0, len(tables))
+	for _, table := range tables {
+		watched = append(watched, WatchedTable{Name: table})
+	}
+	DocumentTableChanges(db, watched...)
+}
+
+// DocumentTableChanges is DocumentDatabaseChanges for tables with other keys, or of which only some rows are relevant
+func DocumentTableChanges(db SqlExecutor, tables ...WatchedTable) {
+	if len(tables) == 0 {
+		watchedDb, watchedTables = nil, nil
+		return
+	}
+	watchedDb, watchedTables = db, tables
+}
+
+// unrecordedKey marks the snapshot queries, a SqlRecorder skips them as they are not run by the application
+type unrecordedKey struct{}
+
+type unrecordedExecutor struct {
+	SqlExecutor
+}
+
+type contextQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (e unrecordedExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if queryer, ok := e.SqlExecutor.(contextQueryer); ok {
+		return queryer.QueryContext(context.WithValue(context.Background(), unrecordedKey{}, true), query, args...)
+	}
+	return e.SqlExecutor.Query(query, args...)
+}
+
+func snapshotTables() map[string][]map[string]interface{} {
+	if watchedDb == nil {
+		return nil
+	}
+	snapshot := make(map[string][]map[string]interface{})
+	for _, table := range watchedTables {
+		builder := PostgresSqlBuilder{}
+		builder.Select(table.Name).Returning("*")
+		if len(table.Where) == 0 {
+			builder.All()
+		} else {
+			builder.WhereExpr(table.Where...)
+		}
+		rows, err := builder.QueryToMap(unrecordedExecutor{watchedDb}, 0)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			continue
+		}
+		for _, row := range rows {
+			for column, value := range row {
+				row[column] = columnValue(value)
+			}
+		}
+		snapshot[table.Name] = rows
+	}
+	return snapshot
+}
+
+func diffSnapshots(before map[string][]map[string]interface{}, after map[string][]map[string]interface{}) []DatabaseChange {
+	changes := make([]DatabaseChange, 0)
+	for _, table := range watchedTables {
+		beforeRows, ok := before[table.Name]
+		if !ok {
+			continue
+		}
+		afterRows, ok := after[table.Name]
+		if !ok {
+			continue
+		}
+
+		key := table.Key
+		if len(key) == 0 {
+			key = []string{"id"}
+		}
+		change := DatabaseChange{Table: table.Name}
+		beforeByKey := make(map[string]map[string]interface{})
+		for _, row := range beforeRows {
+			beforeByKey[rowKey(row, key)] = row
+		}
+		seen := make(map[string]bool)
+		for _, row := range afterRows {
+			rowId := rowKey(row, key)
+			seen[rowId] = true
+			previous, ok := beforeByKey[rowId]
+			if !ok {
+				change.Inserted = append(change.Inserted, row)
+			} else if describeRows([]map[string]interface{}{previous}) != describeRows([]map[string]interface{}{row}) {
+				change.Updated = append(change.Updated, RowChange{Before: previous, After: row})
+			}
+		}
+		for _, row := range beforeRows {
+			if !seen[rowKey(row, key)] {
+				change.Deleted = append(change.Deleted, row)
+			}
+		}
+
+		if len(change.Inserted) > 0 || len(change.Updated) > 0 || len(change.Deleted) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func rowKey(row map[string]interface{}, key []string) string {
+	values := make(map[string]interface{}, len(key))
+	for _, column := range key {
+		value, ok := row[column]
+		if !ok {
+			return describeRows([]map[string]interface{}{row})
+		}
+		values[column] = value
+	}
+	return describeRows([]map[string]interface{}{values})
+}
+
+func sortedColumns(rows ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	columns := make([]string, 0)
+	for _, row := range rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	// The id goes first
+	for i, column := range columns {
+		if column == "id" {
+			columns = append([]string{"id"}, append(columns[:i], columns[i+1:]...)...)
+			break
+		}
+	}
+	return columns
+}
+
+func writeRowsTable(sb *StringBuilder, columns []string, cells [][]string) {
+	sb.Write("         | ", strings.Join(columns, " | "), " |\n")
+	sb.Write("         |", strings.Repeat(" --- |", len(columns)), "\n")
+	for _, row := range cells {
+		sb.Write("         | ", strings.Join(row, " | "), " |\n")
+	}
+	sb.Write("\n")
+}
+
+var cellEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+
+func rowCells(columns []string, rows []map[string]interface{}) [][]string {
+	cells := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		values := make([]string, 0, len(columns))
+		for _, column := range columns {
+			values = append(values, cellEscaper.Replace(fmt.Sprintf("%v", row[column])))
+		}
+		cells = append(cells, values)
+	}
+	return cells
+}
+
+func markdownDatabaseChanges(changes []DatabaseChange) string {
+	sb := StringBuilder{}
+	sb.Write("\n   - Database changes:\n")
+	for _, change := range changes {
+		if len(change.Inserted) > 0 {
+			columns := sortedColumns(change.Inserted...)
+			sb.Write("      - `", change.Table, "` inserted:\n\n")
+			writeRowsTable(&sb, columns, rowCells(columns, change.Inserted))
+		}
+		if len(change.Updated) > 0 {
+			before := make([]map[string]interface{}, 0, len(change.Updated))
+			after := make([]map[string]interface{}, 0, len(change.Updated))
+			for _, updated := range change.Updated {
+				before = append(before, updated.Before)
+				after = append(after, updated.After)
+			}
+			columns := sortedColumns(after...)
+			cells := rowCells(columns, after)
+			for i, previous := range rowCells(columns, before) {
+				for j, value := range previous {
+					if value != cells[i][j] {
+						cells[i][j] = value + " → " + cells[i][j]
+					}
+				}
+			}
+			sb.Write("      - `", change.Table, "` updated:\n\n")
+			writeRowsTable(&sb, columns, cells)
+		}
+		if len(change.Deleted) > 0 {
+			columns := sortedColumns(change.Deleted...)
+			sb.Write("      - `", change.Table, "` deleted:\n\n")
+			writeRowsTable(&sb, columns, rowCells(columns, change.Deleted))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,195 @@
+package httptesting
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Upsert describes the conflict handling of an INSERT, rendered by a Dialect
+type Upsert struct {
+	// ConflictColumns make up the unique constraint, MySQL uses whichever unique key conflicts
+	ConflictColumns []string
+	// ConflictWhere is the predicate of a partial unique index
+	ConflictWhere string
+	// Assignments are rendered "column=value" pairs, no assignments means DO NOTHING
+	Assignments []string
+	// UpdateWhere restricts which conflicting rows are updated
+	UpdateWhere string
+}
+
+// Dialect is the syntax of a database engine
+type Dialect interface {
+	Name() string
+	// Placeholder of the n-th argument, starting at 1
+	Placeholder(n int) string
+	QuoteIdentifier(name string) string
+	SupportsReturning() bool
+	// LimitOffset renders the LIMIT and OFFSET clauses, 0 leaves a clause out
+	LimitOffset(limit int, offset int) string
+	// UpsertClause renders the conflict handling appended to an INSERT
+	UpsertClause(upsert Upsert) string
+	// ExcludedColumn refers to the value a conflicting INSERT proposed for a column
+	ExcludedColumn(name string) string
+	// MaxPlaceholders is the number of arguments a single statement may take
+	MaxPlaceholders() int
+}
+
+type postgresDialect struct{}
+type sqliteDialect struct{}
+type mysqlDialect struct{}
+
+var (
+	// Postgres uses $1 placeholders and "quoted" identifiers
+	Postgres Dialect = postgresDialect{}
+	// Sqlite uses ? placeholders and "quoted" identifiers, RETURNING needs SQLite 3.35
+	Sqlite Dialect = sqliteDialect{}
+	// MySql uses ? placeholders and `quoted` identifiers, and has no RETURNING
+	MySql Dialect = mysqlDialect{}
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.([A-Za-z_][A-Za-z0-9_$]*|\*))*$`)
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (postgresDialect) SupportsReturning() bool {
+	return true
+}
+
+func (postgresDialect) LimitOffset(limit int, offset int) string {
+	return limitOffset(limit, offset)
+}
+
+func (postgresDialect) UpsertClause(upsert Upsert) string {
+	return onConflictClause(upsert)
+}
+
+func (postgresDialect) ExcludedColumn(name string) string {
+	return "EXCLUDED." + name
+}
+
+func (postgresDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (sqliteDialect) SupportsReturning() bool {
+	return true
+}
+
+func (sqliteDialect) LimitOffset(limit int, offset int) string {
+	if limit <= 0 && offset > 0 {
+		// SQLite only takes OFFSET after a LIMIT
+		return " LIMIT -1 OFFSET " + strconv.Itoa(offset)
+	}
+	return limitOffset(limit, offset)
+}
+
+func (sqliteDialect) UpsertClause(upsert Upsert) string {
+	return onConflictClause(upsert)
+}
+
+func (sqliteDialect) ExcludedColumn(name string) string {
+	return "excluded." + name
+}
+
+func (sqliteDialect) MaxPlaceholders() int {
+	// SQLite 3.32 and later, older versions take 999
+	return 32766
+}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (mysqlDialect) SupportsReturning() bool {
+	return false
+}
+
+func (mysqlDialect) LimitOffset(limit int, offset int) string {
+	if limit <= 0 && offset > 0 {
+		// MySQL only takes OFFSET after a LIMIT, this is the documented "all rows" limit
+		return " LIMIT 18446744073709551615 OFFSET " + strconv.Itoa(offset)
+	}
+	return limitOffset(limit, offset)
+}
+
+func (mysqlDialect) UpsertClause(upsert Upsert) string {
+	assignments := upsert.Assignments
+	if len(assignments) == 0 {
+		// DO NOTHING, a no-op assignment keeps the existing row
+		if len(upsert.ConflictColumns) == 0 {
+			return ""
+		}
+		assignments = []string{upsert.ConflictColumns[0] + "=" + upsert.ConflictColumns[0]}
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
+func (mysqlDialect) ExcludedColumn(name string) string {
+	return "VALUES(" + name + ")"
+}
+
+func (mysqlDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func limitOffset(limit int, offset int) string {
+	sb := StringBuilder{}
+	if limit > 0 {
+		sb.Write(" LIMIT ").Write(strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		sb.Write(" OFFSET ").Write(strconv.Itoa(offset))
+	}
+	return sb.String()
+}
+
+func onConflictClause(upsert Upsert) string {
+	sb := StringBuilder{}
+	sb.Write(" ON CONFLICT")
+	if len(upsert.ConflictColumns) > 0 {
+		sb.Write(" (", strings.Join(upsert.ConflictColumns, ", "), ")")
+		if len(upsert.ConflictWhere) > 0 {
+			sb.Write(" WHERE ", upsert.ConflictWhere)
+		}
+	}
+	if len(upsert.Assignments) == 0 {
+		sb.Write(" DO NOTHING")
+		return sb.String()
+	}
+	sb.Write(" DO UPDATE SET ", strings.Join(upsert.Assignments, ", "))
+	if len(upsert.UpdateWhere) > 0 {
+		sb.Write(" WHERE ", upsert.UpdateWhere)
+	}
+	return sb.String()
+}
@@ -0,0 +1,144 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// DiffRecordings compares two recordings and returns a human readable list of differences.
+// Exchanges are matched by name, or by method and route, in order of appearance
+func DiffRecordings(expected *Recording, actual *Recording) []string {
+	differences := make([]string, 0)
+
+	actualByKey := make(map[string][]Exchange)
+	for _, exchange := range actual.Exchanges {
+		key := exchangeKey(exchange)
+		actualByKey[key] = append(actualByKey[key], exchange)
+	}
+
+	seen := make(map[string]int)
+	for _, exchange := range expected.Exchanges {
+		key := exchangeKey(exchange)
+		index := seen[key]
+		seen[key] = index + 1
+
+		candidates := actualByKey[key]
+		if index >= len(candidates) {
+			differences = append(differences, fmt.Sprintf("%s: missing", key))
+			continue
+		}
+		differences = append(differences, diffExchanges(key, exchange, candidates[index])...)
+	}
+
+	for _, exchange := range actual.Exchanges {
+		key := exchangeKey(exchange)
+		if seen[key] > 0 {
+			seen[key]--
+			continue
+		}
+		differences = append(differences, fmt.Sprintf("%s: unexpected", key))
+	}
+	return differences
+}
+
+func exchangeKey(exchange Exchange) string {
+	if len(exchange.Name) > 0 {
+		return exchange.Name
+	}
+	route := exchange.Route
+	if len(route) == 0 {
+		route = urlPath(exchange.Url)
+	}
+	return exchange.Method + " " + route
+}
+
+func diffExchanges(key string, expected Exchange, actual Exchange) []string {
+	differences := make([]string, 0)
+
+	if expected.Status != actual.Status {
+		differences = append(differences, fmt.Sprintf("%s: status %d != %d", key, expected.Status, actual.Status))
+	}
+
+	expectedType := expected.ResponseHeaders.Get("Content-Type")
+	actualType := actual.ResponseHeaders.Get("Content-Type")
+	if expectedType != actualType {
+		differences = append(differences, fmt.Sprintf("%s: Content-Type %q != %q", key, expectedType, actualType))
+	}
+
+	var expectedBody, actualBody interface{}
+	expectedErr := json.Unmarshal([]byte(expected.ResponseBody), &expectedBody)
+	actualErr := json.Unmarshal([]byte(actual.ResponseBody), &actualBody)
+	if expectedErr != nil || actualErr != nil {
+		if expected.ResponseBody != actual.ResponseBody {
+			differences = append(differences, fmt.Sprintf("%s: body %q != %q", key, expected.ResponseBody, actual.ResponseBody))
+		}
+		return differences
+	}
+
+	for _, d := range diffJson("", expectedBody, actualBody) {
+		differences = append(differences, fmt.Sprintf("%s: body%s", key, d))
+	}
+	return differences
+}
+
+func diffJson(path string, expected interface{}, actual interface{}) []string {
+	differences := make([]string, 0)
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0)
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ev, eok := e[k]
+			av, aok := a[k]
+			if !eok {
+				differences = append(differences, fmt.Sprintf("%s.%s: unexpected %s", path, k, jsonString(av)))
+			} else if !aok {
+				differences = append(differences, fmt.Sprintf("%s.%s: missing, expected %s", path, k, jsonString(ev)))
+			} else {
+				differences = append(differences, diffJson(path+"."+k, ev, av)...)
+			}
+		}
+		return differences
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(e) != len(a) {
+			differences = append(differences, fmt.Sprintf("%s: %d items != %d items", path, len(e), len(a)))
+		}
+		for i := 0; i < len(e) && i < len(a); i++ {
+			differences = append(differences, diffJson(path+"["+strconv.Itoa(i)+"]", e[i], a[i])...)
+		}
+		return differences
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		differences = append(differences, fmt.Sprintf("%s: %s != %s", path, jsonString(expected), jsonString(actual)))
+	}
+	return differences
+}
+
+func jsonString(value interface{}) string {
+	jsonDoc, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(jsonDoc)
+}
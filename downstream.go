@@ -0,0 +1,134 @@
+package httptesting
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DownstreamCall is an outbound request made by a handler while serving a documented exchange
+type DownstreamCall struct {
+	Method          string        `json:"method"`
+	Url             string        `json:"url"`
+	RequestHeaders  http.Header   `json:"requestHeaders,omitempty"`
+	RequestBody     string        `json:"requestBody,omitempty"`
+	Status          int           `json:"status,omitempty"`
+	ResponseHeaders http.Header   `json:"responseHeaders,omitempty"`
+	ResponseBody    string        `json:"responseBody,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Duration        time.Duration `json:"-"`
+}
+
+type exchangeCaptureKey struct{}
+
+func withExchangeCapture(ctx context.Context, capture *exchangeCapture) context.Context {
+	return context.WithValue(ctx, exchangeCaptureKey{}, capture)
+}
+
+func (e *exchangeCapture) addDownstreamCall(call DownstreamCall) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.exchange.DownstreamCalls = append(e.exchange.DownstreamCalls, call)
+}
+
+// RecordingTransport is a http.RoundTripper keeping track of outbound calls. Calls made with the context of a
+// documented request, e.g. `req.WithContext(c.Request.Context())`, are listed as downstream calls of its exchange
+type RecordingTransport struct {
+	// Transport makes the actual calls, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	lock  sync.Mutex
+	calls []DownstreamCall
+}
+
+// NewRecordingTransport wraps a transport, e.g. `&http.Client{Transport: httptesting.NewRecordingTransport(nil)}`
+func NewRecordingTransport(transport http.RoundTripper) *RecordingTransport {
+	return &RecordingTransport{Transport: transport, calls: make([]DownstreamCall, 0)}
+}
+
+func (rt *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := rt.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	call := DownstreamCall{Method: req.Method, Url: req.URL.String(), RequestHeaders: req.Header.Clone()}
+	if req.Body != nil && req.Body != http.NoBody {
+		buf, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		// RoundTrippers must not modify the request, the body is replaced on a copy
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
+		call.RequestBody = string(buf)
+	}
+
+	started := time.Now()
+	res, err := transport.RoundTrip(req)
+	call.Duration = time.Since(started)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		buf, readErr := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
+		call.Status = res.StatusCode
+		call.ResponseHeaders = res.Header.Clone()
+		call.ResponseBody = string(buf)
+		if readErr != nil {
+			call.Error = readErr.Error()
+		}
+	}
+
+	rt.lock.Lock()
+	rt.calls = append(rt.calls, call)
+	rt.lock.Unlock()
+
+	if capture, ok := req.Context().Value(exchangeCaptureKey{}).(*exchangeCapture); ok {
+		capture.addDownstreamCall(call)
+	}
+	return res, err
+}
+
+func (rt *RecordingTransport) Calls() []DownstreamCall {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	return append([]DownstreamCall{}, rt.calls...)
+}
+
+// CallsTo returns the calls with a given method to a path, which may be a route template like /users/:id
+func (rt *RecordingTransport) CallsTo(method string, path string) []DownstreamCall {
+	calls := make([]DownstreamCall, 0)
+	for _, call := range rt.Calls() {
+		if !strings.EqualFold(call.Method, method) {
+			continue
+		}
+		if _, ok := matchRoute(path, strings.SplitN(urlPath(call.Url), "?", 2)[0]); ok {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (rt *RecordingTransport) Reset() {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.calls = make([]DownstreamCall, 0)
+}
+
+// AssertDownstreamCalls checks the number of calls with a given method to a path, e.g. exactly one POST to /charge
+func AssertDownstreamCalls(t testing.TB, transport *RecordingTransport, method string, path string, expectedCount int) []DownstreamCall {
+	t.Helper()
+	calls := transport.CallsTo(method, path)
+	if len(calls) != expectedCount {
+		t.Errorf("Unexpected number of %s %s calls: %d, expected %d\n", method, path, len(calls), expectedCount)
+	}
+	return calls
+}
@@ -0,0 +1,356 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/elliotchance/orderedmap"
+	"gopkg.in/yaml.v2"
+)
+
+// FixtureRow is a row to insert. Rows with a Ref capture their Returning columns, later rows refer to them as {{table.ref.column}}
+type FixtureRow struct {
+	Ref     string
+	Columns *orderedmap.OrderedMap
+}
+
+// FixtureTable lists the rows to insert into a table
+type FixtureTable struct {
+	Name string
+	Rows []FixtureRow
+}
+
+// Fixtures is seed data, loaded from YAML or JSON files mapping a table name to a list of rows:
+//
+//	users:
+//	  - _ref: alice
+//	    name: Alice
+//	orders:
+//	  - user_id: "{{users.alice.id}}"
+//	    amount: 10
+//
+// Tables are inserted in the order of the files, except that tables referenced with {{table.ref.column}} or by
+// a foreign key go first. Foreign keys are read from the Postgres catalog, DependsOn overrides them per table
+type Fixtures struct {
+	Tables []FixtureTable
+	// Returning columns captured for rows with a _ref, id by default
+	Returning []string
+	// Tables which have to be inserted before a table, e.g. {"orders": {"users"}}, in place of its foreign keys
+	DependsOn map[string][]string
+}
+
+var fixtureReferencePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\.([A-Za-z0-9_]+)\.([A-Za-z0-9_]+)\s*\}\}`)
+
+// ParseFixtures reads YAML or JSON fixtures, tables and columns keep the order of the document
+func ParseFixtures(content []byte) (*Fixtures, error) {
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	fixtures := &Fixtures{Tables: make([]FixtureTable, 0), Returning: []string{"id"}}
+	for _, item := range document {
+		table := FixtureTable{Name: fmt.Sprintf("%v", item.Key), Rows: make([]FixtureRow, 0)}
+
+		// Rows are decoded again as ordered maps, so columns keep their order
+		rowsContent, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		var rows []yaml.MapSlice
+		if err := yaml.Unmarshal(rowsContent, &rows); err != nil {
+			return nil, fmt.Errorf("table %s: rows have to be a list of column maps: %s", table.Name, err.Error())
+		}
+
+		for _, row := range rows {
+			fixtureRow := FixtureRow{Columns: orderedmap.NewOrderedMap()}
+			for _, column := range row {
+				name := fmt.Sprintf("%v", column.Key)
+				if name == "_ref" {
+					fixtureRow.Ref = fmt.Sprintf("%v", column.Value)
+					continue
+				}
+				fixtureRow.Columns.Set(name, fixtureValue(column.Value))
+			}
+			table.Rows = append(table.Rows, fixtureRow)
+		}
+		fixtures.Tables = append(fixtures.Tables, table)
+	}
+	return fixtures, nil
+}
+
+func LoadFixtureFiles(fileNames ...string) (*Fixtures, error) {
+	fixtures := &Fixtures{Tables: make([]FixtureTable, 0), Returning: []string{"id"}}
+	for _, fileName := range fileNames {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		f, err := ParseFixtures(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fileName, err.Error())
+		}
+		fixtures.Tables = append(fixtures.Tables, f.Tables...)
+	}
+	return fixtures, nil
+}
+
+// LoadFixtures inserts the rows of fixture files into a database or transaction
+func LoadFixtures(db SqlExecutor, fileNames ...string) error {
+	fixtures, err := LoadFixtureFiles(fileNames...)
+	if err != nil {
+		return err
+	}
+	return fixtures.Insert(db)
+}
+
+// Insert inserts the rows, tables referenced by other tables go first. Captured columns are registered
+// as variables, so request templates can use them too, e.g. /users/{{users.alice.id}}
+func (f *Fixtures) Insert(db SqlExecutor) error {
+	tables, err := f.orderedTables(foreignKeys(db))
+	if err != nil {
+		return err
+	}
+
+	captures := make(map[string]interface{})
+	for _, table := range tables {
+		for i, row := range table.Rows {
+			columns := orderedmap.NewOrderedMap()
+			for _, k := range row.Columns.Keys() {
+				value, _ := row.Columns.Get(k)
+				value, err := resolveFixtureValue(value, captures)
+				if err != nil {
+					return fmt.Errorf("%s row %d: %s", table.Name, i+1, err.Error())
+				}
+				columns.Set(k, value)
+			}
+
+			builder := PostgresSqlBuilder{}
+			builder.Insert(table.Name).Set(columns)
+			if len(row.Ref) > 0 {
+				builder.Returning(f.Returning...)
+			}
+			query, inArgs, outArgs, err := builder.Build()
+			if err != nil {
+				return fmt.Errorf("%s row %d: %s", table.Name, i+1, err.Error())
+			}
+
+			if len(row.Ref) == 0 || len(outArgs) == 0 {
+				if _, err := db.Exec(query, inArgs...); err != nil {
+					return fmt.Errorf("%s row %d: %s", table.Name, i+1, err.Error())
+				}
+				continue
+			}
+
+			values := make([]interface{}, len(outArgs))
+			pointers := make([]interface{}, len(outArgs))
+			for j := range values {
+				pointers[j] = &values[j]
+			}
+			if err := db.QueryRow(query, inArgs...).Scan(pointers...); err != nil {
+				return fmt.Errorf("%s row %d: %s", table.Name, i+1, err.Error())
+			}
+
+			captured := make(map[string]interface{})
+			for j, name := range outArgs {
+				if b, ok := values[j].([]byte); ok {
+					values[j] = string(b)
+				}
+				captured[name] = values[j]
+			}
+			refs, ok := captures[table.Name].(map[string]interface{})
+			if !ok {
+				refs = make(map[string]interface{})
+				captures[table.Name] = refs
+			}
+			refs[row.Ref] = captured
+		}
+	}
+
+	variablesLock.Lock()
+	defer variablesLock.Unlock()
+	for table, refs := range captures {
+		existing, ok := variables[table].(map[string]interface{})
+		if !ok {
+			variables[table] = refs
+			continue
+		}
+		for ref, captured := range refs.(map[string]interface{}) {
+			existing[ref] = captured
+		}
+	}
+	return nil
+}
+
+const foreignKeysQuery = `SELECT DISTINCT tc.table_name, ccu.table_name FROM information_schema.table_constraints tc
+JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_schema = tc.constraint_schema AND ccu.constraint_name = tc.constraint_name
+WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()`
+
+// foreignKeys lists the tables each table refers to, nil when the catalog can't be read, e.g. on SQLite
+func foreignKeys(db SqlExecutor) map[string][]string {
+	rows, err := unrecordedExecutor{db}.Query(foreignKeysQuery)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	keys := make(map[string][]string)
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return nil
+		}
+		keys[table] = append(keys[table], referenced)
+	}
+	if rows.Err() != nil {
+		return nil
+	}
+	return keys
+}
+
+func (f *Fixtures) orderedTables(foreignKeys map[string][]string) ([]FixtureTable, error) {
+	listed := make(map[string]bool)
+	for _, table := range f.Tables {
+		listed[table.Name] = true
+	}
+
+	dependencies := make(map[string]map[string]bool)
+	for _, table := range f.Tables {
+		if dependencies[table.Name] == nil {
+			dependencies[table.Name] = make(map[string]bool)
+		}
+		dependsOn, ok := f.DependsOn[table.Name]
+		if !ok {
+			dependsOn = foreignKeys[table.Name]
+		}
+		// Tables without fixtures don't need to wait for anything
+		for _, dependency := range dependsOn {
+			if listed[dependency] && dependency != table.Name {
+				dependencies[table.Name][dependency] = true
+			}
+		}
+		for _, row := range table.Rows {
+			for _, k := range row.Columns.Keys() {
+				value, _ := row.Columns.Get(k)
+				s, ok := value.(string)
+				if !ok {
+					continue
+				}
+				for _, match := range fixtureReferencePattern.FindAllStringSubmatch(s, -1) {
+					if match[1] != table.Name {
+						dependencies[table.Name][match[1]] = true
+					}
+				}
+			}
+		}
+	}
+
+	ordered := make([]FixtureTable, 0, len(f.Tables))
+	inserted := make(map[string]bool)
+	for len(ordered) < len(f.Tables) {
+		progress := false
+		for _, table := range f.Tables {
+			if inserted[table.Name] {
+				continue
+			}
+			ready := true
+			for dependency := range dependencies[table.Name] {
+				if !inserted[dependency] {
+					ready = false
+				}
+			}
+			if !ready {
+				continue
+			}
+			// A table may be listed in several files
+			for _, t := range f.Tables {
+				if t.Name == table.Name {
+					ordered = append(ordered, t)
+				}
+			}
+			inserted[table.Name] = true
+			progress = true
+		}
+		if !progress {
+			pending := make([]string, 0)
+			for _, table := range f.Tables {
+				if !inserted[table.Name] {
+					pending = append(pending, table.Name)
+				}
+			}
+			return nil, errors.New("Circular or unknown fixture references between tables: " + strings.Join(pending, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// A value made of a single reference keeps the captured type
+func resolveFixtureValue(value interface{}, captures map[string]interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	lookup := func(match []string) (interface{}, error) {
+		refs, _ := captures[match[1]].(map[string]interface{})
+		captured, _ := refs[match[2]].(map[string]interface{})
+		v, ok := captured[match[3]]
+		if !ok {
+			return nil, fmt.Errorf("unknown reference %s", match[0])
+		}
+		return v, nil
+	}
+
+	if match := fixtureReferencePattern.FindStringSubmatch(s); match != nil && match[0] == strings.TrimSpace(s) {
+		return lookup(match)
+	}
+
+	var err error
+	result := fixtureReferencePattern.ReplaceAllStringFunc(s, func(reference string) string {
+		v, lookupErr := lookup(fixtureReferencePattern.FindStringSubmatch(reference))
+		if lookupErr != nil {
+			err = lookupErr
+			return reference
+		}
+		return fmt.Sprintf("%v", v)
+	})
+	return result, err
+}
+
+func fixtureValue(value interface{}) interface{} {
+	switch value.(type) {
+	case yaml.MapSlice, map[interface{}]interface{}, []interface{}:
+		jsonDoc, err := json.Marshal(normalizeYaml(mapSliceToMap(value)))
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(jsonDoc)
+	}
+	return value
+}
+
+func mapSliceToMap(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		result := make(map[interface{}]interface{})
+		for _, item := range v {
+			result[item.Key] = mapSliceToMap(item.Value)
+		}
+		return result
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			v[k] = mapSliceToMap(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mapSliceToMap(item)
+		}
+		return v
+	}
+	return value
+}
@@ -6,14 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hoisie/mustache"
@@ -50,6 +51,8 @@ var docFile *os.File
 var httpFile *os.File
 var baseUrl string
 var variables map[string]interface{} = make(map[string]interface{})
+var variablesLock sync.Mutex
+var requestCounter int64
 
 func Prepare(docFileName string) {
 	// Don't foget to call r.Use(MarkdownDebugLogger())
@@ -58,7 +61,7 @@ func Prepare(docFileName string) {
 		var err error
 		docFile, err = os.Create(docFileName)
 		if err != nil {
-			fmt.Errorf("cannot open %s: %v", docFileName, err)
+			fmt.Printf("Error: cannot open %s: %v\n", docFileName, err)
 		}
 	}
 }
@@ -70,7 +73,7 @@ func PrepareWithHttpDoc(docFileName string, httpFileName string, baseUrlParam st
 		var err error
 		docFile, err = os.Create(docFileName)
 		if err != nil {
-			fmt.Errorf("cannot open %s: %v", docFileName, err)
+			fmt.Printf("Error: cannot open %s: %v\n", docFileName, err)
 		}
 	}
 
@@ -78,7 +81,7 @@ func PrepareWithHttpDoc(docFileName string, httpFileName string, baseUrlParam st
 		var err error
 		httpFile, err = os.Create(httpFileName)
 		if err != nil {
-			fmt.Errorf("cannot open %s: %v", httpFileName, err)
+			fmt.Printf("Error: cannot open %s: %v\n", httpFileName, err)
 		} else {
 			httpFile.WriteString(fmt.Sprintf("@baseUrl = %s\n\n", baseUrlParam))
 		}
@@ -90,14 +93,27 @@ func Teardown() {
 	if docFile != nil {
 		err := docFile.Close()
 		if err != nil {
-			fmt.Errorf("cannot close markdown file: %v", err)
+			fmt.Printf("Error: cannot close markdown file: %v\n", err)
 		}
 	}
 
 	if httpFile != nil {
 		err := httpFile.Close()
 		if err != nil {
-			fmt.Errorf("cannot close http file: %v", err)
+			fmt.Printf("Error: cannot close http file: %v\n", err)
+		}
+	}
+
+	closeTestServers()
+
+	if recordingFile != nil {
+		err := writeRecording()
+		if err != nil {
+			fmt.Printf("Error: cannot write recording: %v\n", err)
+		}
+		err = recordingFile.Close()
+		if err != nil {
+			fmt.Printf("Error: cannot close recording file: %v\n", err)
 		}
 	}
 }
@@ -116,7 +132,9 @@ func ExtractVariables(w *httptest.ResponseRecorder, responseVariables []Response
 		httpFile.WriteString("\n")
 		for _, responseVariable := range responseVariables {
 			httpFile.WriteString(fmt.Sprintf("@%s = {{%s}}\n", responseVariable.Variable, responseVariable.Expression))
+			variablesLock.Lock()
 			variables[responseVariable.Variable] = responseVariable.Value
+			variablesLock.Unlock()
 		}
 		httpFile.WriteString("\n")
 	}
@@ -124,112 +142,32 @@ func ExtractVariables(w *httptest.ResponseRecorder, responseVariables []Response
 
 func MarkdownDebugLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		description := c.Request.Header["__httptesting_desc"][0]
-		name := c.Request.Header["__httptesting_name"][0]
-
-		if docFile != nil && len(description) > 0 {
-			url := c.Request.URL.String()
-			for _, p := range c.Params {
-				url = strings.Replace(url, p.Value, ":"+p.Key, 1)
-			}
-
-			if httpFile != nil {
-				httpFile.WriteString("###\n")
-
-				httpFile.WriteString(fmt.Sprintf("# %s\n", description))
-				if len(name) > 0 {
-					httpFile.WriteString(fmt.Sprintf("# @name %s\n", name))
-				}
-				httpFile.WriteString(fmt.Sprintf("%s {{baseUrl}}%s\n", c.Request.Method, url))
-			}
-
-			docFile.WriteString(fmt.Sprintf("\n* %s `%s` %s\n\n", c.Request.Method, url, description))
-			docFile.WriteString("   - Request:\n")
-			if len(c.Request.Header) > 0 {
-				docFile.WriteString("      - Headers:\n")
-
-				for k, v := range c.Request.Header {
-					for i, v1 := range v {
-						if strings.Index(k, "__httptesting") != 0 {
-
-							if httpFile != nil {
-								httpFile.WriteString(fmt.Sprintf("%s: %s\n", k, v1))
-							}
-							v[i] = PopulateVariables(v1)
-							docFile.WriteString(fmt.Sprintf("         - `%s`: `%s`\n", k, v1))
-						}
-
-					}
-				}
-				httpFile.WriteString("\n")
-			}
-
-			if c.Request.Body != nil {
-				buf, _ := ioutil.ReadAll(c.Request.Body)
-				reader1 := ioutil.NopCloser(bytes.NewBuffer(buf))
-				reader2 := ioutil.NopCloser(bytes.NewBuffer(buf))
-				body := parseBody(reader1)
-				requestBody := indent(body)
-
-				docFile.WriteString(fmt.Sprintf("      - Body:\n\t\t```json\n%s\t\t```\n", requestBody))
-				if httpFile != nil {
-					httpFile.WriteString(fmt.Sprintf("%s\n", body))
-				}
-
-				c.Request.Body = reader2
-			}
-
-			if httpFile != nil {
-				httpFile.WriteString("\n")
-			}
+		capture := captureRequest(c.Request)
+		if capture == nil {
+			c.Next()
+			return
 		}
+		c.Request = c.Request.WithContext(withExchangeCapture(c.Request.Context(), capture))
 
 		wr := &WriterWrapper{Body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
 		c.Writer = wr
 		c.Next()
 
-		var response map[string]interface{}
-		body := wr.Body.String()
-
-		docFile.WriteString(fmt.Sprintf("\n   - Response (%d)\n", c.Writer.Status()))
-
-		if len(c.Writer.Header()) > 0 {
-			docFile.WriteString("      - Headers:\n")
-
-			for k, v := range c.Writer.Header() {
-				for _, v1 := range v {
-					docFile.WriteString(fmt.Sprintf("         - `%s`: `%s`\n", k, v1))
-				}
-			}
-		}
-
-		err := json.Unmarshal([]byte(body), &response)
-		if err != nil {
-			fmt.Errorf("Unable to parse the json response %d\n", err)
-			if docFile != nil && len(description) > 0 {
-				docFile.WriteString(fmt.Sprintf("\n      - Body:\n\t\t```text\n%s\t\t```\n", indent(body)))
-			}
-		} else {
-			jsonDoc, _ := json.MarshalIndent(response, "", "\t")
-
-			if docFile != nil && len(description) > 0 {
-				docFile.WriteString(fmt.Sprintf("\n      - Body:\n\t\t```json\n%s\t\t```\n", indent(string(jsonDoc))))
-			}
+		// Route template as registered with gin, actual values are documented in the path parameter table
+		params := make([]PathParam, 0, len(c.Params))
+		for _, p := range c.Params {
+			params = append(params, PathParam{Key: p.Key, Value: p.Value})
 		}
-
+		capture.complete(c.FullPath(), params, c.Writer.Status(), c.Writer.Header(), wr.Body.String())
 	}
 }
 
 func PopulateVariables(template string) string {
+	variablesLock.Lock()
+	defer variablesLock.Unlock()
 	return mustache.Render(template, variables)
 }
 
-func parseBody(reader io.Reader) string {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(reader)
-	return buf.String()
-}
-
 func indent(body string) string {
 	lines := strings.Split(body, "\n")
 	sb := StringBuilder{}
@@ -241,8 +179,8 @@ func indent(body string) string {
 	return sb.String()
 }
 
-// Makes a call to a url exposed by a Gin engine, logging request and a response
-func PerformRequest(r *gin.Engine, request HttpRequest) *httptest.ResponseRecorder {
+// Makes a call to a url exposed by a Gin engine, or any other http.Handler, logging request and a response
+func PerformRequest(r http.Handler, request HttpRequest) *httptest.ResponseRecorder {
 	var body io.Reader = nil
 	if "GET" != request.Method {
 		if request.Body != nil {
@@ -261,6 +199,10 @@ func PerformRequest(r *gin.Engine, request HttpRequest) *httptest.ResponseRecord
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("__httptesting_desc", request.Description)
 	req.Header.Set("__httptesting_name", request.Name)
+	id := strconv.FormatInt(atomic.AddInt64(&requestCounter, 1), 10)
+	req.Header.Set("__httptesting_id", id)
+	pending := registerPendingRequest(id, request)
+	defer takePendingRequest(id)
 
 	if request.Headers != nil {
 		for k, v := range request.Headers {
@@ -268,20 +210,22 @@ func PerformRequest(r *gin.Engine, request HttpRequest) *httptest.ResponseRecord
 		}
 	}
 
+	if networkMode != InProcess {
+		return performNetworkRequest(r, req, pending)
+	}
+
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	return w
 }
 
-// Makes a call to a fully qualified remote url
-func PerformRemoteRequest(request HttpRequest) ([]byte, error) {
+func newRemoteRequest(request HttpRequest) (*http.Request, error) {
 	var body io.Reader = nil
 	if "GET" != request.Method {
 		if request.Body != nil {
 			jsonDoc, err := json.MarshalIndent(request.Body, "", "\t")
 			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
 				return nil, err
 			}
 			body = bytes.NewBuffer(jsonDoc)
@@ -291,7 +235,10 @@ func PerformRemoteRequest(request HttpRequest) ([]byte, error) {
 		}
 	}
 
-	req, _ := http.NewRequest(request.Method, request.Path, body)
+	req, err := http.NewRequest(request.Method, request.Path, body)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	if request.Headers != nil {
@@ -299,22 +246,7 @@ func PerformRemoteRequest(request HttpRequest) ([]byte, error) {
 			req.Header.Set(k, v)
 		}
 	}
-
-	client := http.Client{Timeout: time.Second * 10}
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
-		return nil, err
-	}
-
-	return bodyBytes, nil
+	return req, nil
 }
 
 func AssertStatusCode(t *testing.T, w *httptest.ResponseRecorder, expectedStatusCode int) {
@@ -0,0 +1,194 @@
+package httptesting
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HttpVariable is a `@name = value` definition of an RFC2616 (.http) file
+type HttpVariable struct {
+	Name  string
+	Value string
+}
+
+// HttpFile is the parsed content of a .http file, as produced by PrepareWithHttpDoc()
+type HttpFile struct {
+	Variables []HttpVariable
+	Requests  []HttpRequest
+}
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true, "TRACE": true, "CONNECT": true}
+
+func LoadHttpFile(fileName string) (*HttpFile, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result, err := ParseHttpFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", fileName, err)
+	}
+	return result, nil
+}
+
+// ParseHttpFile parses requests separated by `###`, with `# description`, `# @name name`,
+// a request line, headers and an optional body
+func ParseHttpFile(reader io.Reader) (*HttpFile, error) {
+	result := HttpFile{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	block := make([]string, 0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "###") {
+			if err := parseHttpBlock(&result, block); err != nil {
+				return nil, err
+			}
+			block = make([]string, 0)
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := parseHttpBlock(&result, block); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func parseHttpBlock(result *HttpFile, lines []string) error {
+	request := HttpRequest{Headers: make(map[string]string)}
+	requestLine := false
+	headers := true
+	body := StringBuilder{}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if !requestLine {
+			if len(trimmed) == 0 {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "@") {
+				parts := strings.SplitN(trimmed[1:], "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("malformed variable definition: %s", trimmed)
+				}
+				result.Variables = append(result.Variables, HttpVariable{Name: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])})
+				continue
+			}
+			if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+				comment := strings.TrimSpace(strings.TrimLeft(trimmed, "#/"))
+				if strings.HasPrefix(comment, "@name ") {
+					request.Name = strings.TrimSpace(strings.TrimPrefix(comment, "@name "))
+				} else if len(request.Description) == 0 {
+					request.Description = comment
+				}
+				continue
+			}
+
+			fields := strings.Fields(trimmed)
+			if len(fields) < 2 || !httpMethods[strings.ToUpper(fields[0])] {
+				return fmt.Errorf("malformed request line: %s", trimmed)
+			}
+			request.Method = strings.ToUpper(fields[0])
+			request.Path = fields[1]
+			requestLine = true
+			continue
+		}
+
+		if headers {
+			if len(trimmed) == 0 {
+				headers = false
+				continue
+			}
+			parts := strings.SplitN(trimmed, ":", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("malformed header: %s", trimmed)
+			}
+			request.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			continue
+		}
+
+		body.Write(line, "\n")
+	}
+
+	if !requestLine {
+		if len(request.Name) > 0 {
+			return errors.New("request name without a request: " + request.Name)
+		}
+		return nil
+	}
+
+	request.Payload = strings.TrimSpace(body.String())
+	result.Requests = append(result.Requests, request)
+	return nil
+}
+
+// Variable returns the value of a file level variable, such as baseUrl
+func (f *HttpFile) Variable(name string) string {
+	for _, v := range f.Variables {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// Scenario converts the file into a scenario. Variables that capture a response of a named
+// request, like `@authToken = {{login.response.body.AuthToken}}`, become ResponseVariables
+// of that request
+func (f *HttpFile) Scenario(name string) Scenario {
+	scenario := Scenario{Name: name, Variables: make(map[string]string)}
+
+	for _, request := range f.Requests {
+		scenario.Steps = append(scenario.Steps, ScenarioStep{HttpRequest: request})
+	}
+
+	for _, v := range f.Variables {
+		expression := strings.TrimSpace(v.Value)
+		if strings.HasPrefix(expression, "{{") && strings.HasSuffix(expression, "}}") {
+			expression = strings.TrimSpace(expression[2 : len(expression)-2])
+			parts := strings.SplitN(expression, ".", 2)
+			if len(parts) == 2 && strings.HasPrefix(parts[1], "response.") {
+				if step := scenario.step(parts[0]); step != nil {
+					step.ResponseVariables = append(step.ResponseVariables, ResponseVariable{Variable: v.Name, Expression: expression})
+					continue
+				}
+			}
+		}
+		scenario.Variables[v.Name] = v.Value
+	}
+	return scenario
+}
+
+// Recording converts the requests of the file into a recording without responses
+func (f *HttpFile) Recording() *Recording {
+	result := Recording{BaseUrl: f.Variable("baseUrl"), Exchanges: make([]Exchange, 0)}
+	for _, request := range f.Requests {
+		path := strings.Replace(request.Path, "{{baseUrl}}", "", 1)
+		exchange := Exchange{
+			Name:           request.Name,
+			Description:    request.Description,
+			Method:         request.Method,
+			Url:            path,
+			Route:          path,
+			RequestHeaders: make(map[string][]string),
+			RequestBody:    request.Payload,
+		}
+		for k, v := range request.Headers {
+			exchange.RequestHeaders.Set(k, v)
+		}
+		result.Exchanges = append(result.Exchanges, exchange)
+	}
+	return &result
+}
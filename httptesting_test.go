@@ -1,9 +1,22 @@
 package httptesting
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,6 +31,7 @@ func TestMain(m *testing.M) {
 
 	//Prepare("chitchat.md") // If you only need markdown docs
 	PrepareWithHttpDoc("chitchat.md", "chitchat.http", "https://www.example.com") // If you need markdown docs and the RFC2616 file
+	PrepareRecording("chitchat.json")                                             // If you need a machine readable recording
 	code := m.Run()
 	Teardown()
 	os.Exit(code)
@@ -36,6 +50,69 @@ func TestPOSTRequest(t *testing.T) {
 	AssertResponseStatus(t, w, "HELLO")
 }
 
+type EchoTag struct {
+	Name string `json:"name" validate:"required" doc:"Tag name"`
+}
+
+type EchoRequest struct {
+	Status  string    `json:"Status" binding:"required" doc:"Status to echo back"`
+	Comment *string   `json:"comment,omitempty" doc:"Free form comment"`
+	Tags    []EchoTag `json:"tags"`
+	ignored string
+}
+
+func TestPOSTStructRequest(t *testing.T) {
+	w := PerformRequest(r, HttpRequest{Method: "POST", Path: "/echo", Description: "Test POST Endpoint with a struct body", Body: EchoRequest{Status: "HELLO", Tags: []EchoTag{{Name: "greeting"}}}})
+	AssertResponseStatus(t, w, "HELLO")
+
+	exchanges := Exchanges()
+	fields := exchanges[len(exchanges)-1].RequestSchema
+	if len(fields) != 4 {
+		t.Fatalf("Should describe 4 fields: %v", fields)
+	}
+	if fields[0] != (SchemaField{Name: "Status", Type: "string", JsonType: "string", Required: true, Description: "Status to echo back"}) {
+		t.Errorf("Unexpected field: %v", fields[0])
+	}
+	if fields[3] != (SchemaField{Name: "tags[].name", Type: "string", JsonType: "string", Required: true, Description: "Tag name"}) {
+		t.Errorf("Unexpected field: %v", fields[3])
+	}
+
+	content, _ := ToOpenApi("chitchat", &Recording{Exchanges: exchanges[len(exchanges)-1:]})
+	if !strings.Contains(string(content), `"required": [`) || !strings.Contains(string(content), `"description": "Tag name"`) {
+		t.Errorf("Request schema should come from the struct: %s", string(content))
+	}
+}
+
+type EchoRole string
+
+func TestDescribeBodyJsonTypes(t *testing.T) {
+	body := struct {
+		Role     EchoRole      `json:"role"`
+		Timeout  time.Duration `json:"timeout"`
+		Position [2]float64    `json:"position"`
+		Roles    []EchoRole    `json:"roles"`
+		Avatar   []byte        `json:"avatar"`
+		Created  *time.Time    `json:"created"`
+		Extra    interface{}   `json:"extra"`
+	}{}
+
+	expected := []string{"string", "integer", "[]number", "[]string", "string byte", "string date-time", ""}
+	fields := DescribeBody(body)
+	if len(fields) != len(expected) {
+		t.Fatalf("Should describe %d fields: %v", len(expected), fields)
+	}
+	for i, field := range fields {
+		if field.JsonType != expected[i] {
+			t.Errorf("Field %s should be %q, not %q", field.Name, expected[i], field.JsonType)
+		}
+	}
+
+	schema := openApiSchemaOfFields(fields)["properties"].(map[string]interface{})
+	if position := schema["position"].(map[string]interface{}); position["type"] != "array" || position["items"].(map[string]interface{})["type"] != "number" {
+		t.Errorf("Arrays should be documented with their element type: %v", position)
+	}
+}
+
 func TestPOSTNamedRequest(t *testing.T) {
 
 	req := gin.H{"Status": "HELLO"}
@@ -48,12 +125,513 @@ func TestPOSTNamedRequest(t *testing.T) {
 	AssertResponseStatus(t, w, "somevalue")
 }
 
+func TestRepeatedRouteParamRequest(t *testing.T) {
+	w := PerformRequest(r, HttpRequest{Method: "GET", Path: "/users/1/orders/1?expand=1", Description: "Test GET Endpoint with repeated route param values"})
+	AssertResponseStatus(t, w, "1/1")
+
+	exchanges := Exchanges()
+	exchange := exchanges[len(exchanges)-1]
+	if exchange.Route != "/users/:user/orders/:order" {
+		t.Errorf("Route template should come from gin: %s", exchange.Route)
+	}
+	if exchange.Url != "/users/1/orders/1?expand=1" {
+		t.Errorf("Concrete url should be preserved: %s", exchange.Url)
+	}
+	if exchange.PathParams["user"] != "1" || exchange.PathParams["order"] != "1" {
+		t.Errorf("Unexpected path params: %v", exchange.PathParams)
+	}
+}
+
+func TestNetworkModeRequest(t *testing.T) {
+	defer UseNetworkMode(InProcess)
+
+	for _, mode := range []NetworkMode{HttpServer, TlsServer} {
+		UseNetworkMode(mode)
+		w := PerformRequest(r, HttpRequest{Method: "POST", Path: "/echo?mode=" + strconv.Itoa(int(mode)), Description: "Test POST Endpoint over a real socket", Body: gin.H{"Status": "HELLO"}})
+		AssertStatusCode(t, w, 200)
+		AssertResponseStatus(t, w, "HELLO")
+
+		if w.Header().Get("Content-Length") != "18" {
+			t.Errorf("Content-Length should be set by net/http: %v", w.Header())
+		}
+
+		exchanges := Exchanges()
+		exchange := exchanges[len(exchanges)-1]
+		if exchange.Url != "/echo?mode="+strconv.Itoa(int(mode)) || exchange.RequestHeaders.Get("Content-Length") != "22" || exchange.Status != 200 {
+			t.Errorf("Exchange should be documented: %v", exchange)
+		}
+	}
+
+	if TestServer(r).TLS == nil {
+		t.Errorf("TlsServer mode should start a TLS server")
+	}
+}
+
+func TestNetworkModeHandlerFunc(t *testing.T) {
+	defer UseNetworkMode(InProcess)
+	UseNetworkMode(HttpServer)
+
+	handler := MarkdownDebugMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"Status": "OK"}`))
+	}))
+
+	servers := len(testServers)
+	for i := 0; i < 3; i++ {
+		w := PerformRequest(handler, HttpRequest{Method: "GET", Path: "/func"})
+		AssertResponseStatus(t, w, "OK")
+	}
+	if len(testServers) != servers+3 {
+		t.Fatalf("A server should be started for every request to a handler func: %d", len(testServers)-servers)
+	}
+	server := TestServer(handler)
+	if server == testServers[len(testServers)-2].server {
+		t.Errorf("The server of a handler func should not be reused")
+	}
+
+	// Comparable handlers share a server
+	mux := http.NewServeMux()
+	mux.Handle("/func", handler)
+	if TestServer(mux) != TestServer(mux) {
+		t.Errorf("The server should be reused")
+	}
+
+	closeTestServers()
+	if res, err := http.Get(server.URL + "/func"); err == nil {
+		res.Body.Close()
+		t.Errorf("The server should be closed")
+	}
+}
+
 func TestPUTRouteParamRequest(t *testing.T) {
 	req := gin.H{"Status": "HELLO"}
 	w := PerformRequest(r, HttpRequest{Method: "PUT", Path: "/param/somevalue", Description: "Test PUT Endpoint with route param", Body: req})
 	AssertResponseStatus(t, w, "somevalue")
 }
 
+const testHttpFile = `@baseUrl = https://www.example.com
+
+###
+# Test POST Auth Endpoint
+# @name login
+POST {{baseUrl}}/login
+Content-Type: application/json
+
+{
+	"Status": "HELLO"
+}
+
+###
+
+@authToken = {{login.response.body.AuthToken}}
+
+###
+# Test GET Endpoint with route param
+GET {{baseUrl}}/param/somevalue
+Authorization: Bearer {{authToken}}
+
+`
+
+func TestParseHttpFile(t *testing.T) {
+	httpFile, err := ParseHttpFile(strings.NewReader(testHttpFile))
+	if err != nil {
+		t.Fatalf("Cannot parse: %s", err.Error())
+	}
+
+	if httpFile.Variable("baseUrl") != "https://www.example.com" {
+		t.Errorf("Unexpected baseUrl: %v", httpFile.Variables)
+	}
+
+	if len(httpFile.Requests) != 2 {
+		t.Fatalf("Should contain 2 requests: %v", httpFile.Requests)
+	}
+
+	login := httpFile.Requests[0]
+	if login.Name != "login" || login.Method != "POST" || login.Path != "{{baseUrl}}/login" || login.Description != "Test POST Auth Endpoint" {
+		t.Errorf("Unexpected request: %v", login)
+	}
+
+	if login.Payload != "{\n\t\"Status\": \"HELLO\"\n}" {
+		t.Errorf("Unexpected payload: %q", login.Payload)
+	}
+
+	scenario := httpFile.Scenario("chitchat")
+	if len(scenario.Steps[0].ResponseVariables) != 1 || scenario.Steps[0].ResponseVariables[0].Expression != "login.response.body.AuthToken" {
+		t.Errorf("Response variable should be attached to login: %v", scenario.Steps[0])
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	httpFile, _ := ParseHttpFile(strings.NewReader(testHttpFile))
+	scenario := httpFile.Scenario("chitchat")
+	scenario.Steps[1].ExpectResponseStatus = "somevalue"
+
+	runner := NewRunner(server.URL)
+	results := runner.Run(&scenario)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%s %s failed: %s", result.Step.Method, result.Step.Path, result.Err.Error())
+		}
+	}
+
+	if runner.Recording().Exchanges[1].RequestHeaders.Get("Authorization") != "Bearer token body" {
+		t.Errorf("authToken should be populated from the login response: %v", runner.Recording().Exchanges[1].RequestHeaders)
+	}
+
+	scenario = Scenario{Steps: []ScenarioStep{{HttpRequest: HttpRequest{Method: "GET", Path: "/test"}, ExpectResponseStatus: "FAIL"}}}
+	results = runner.Run(&scenario)
+	if results[0].Err == nil {
+		t.Errorf("Mismatching response status should fail the step")
+	}
+}
+
+func TestConvertRecording(t *testing.T) {
+	rec := &Recording{BaseUrl: "https://www.example.com", Exchanges: []Exchange{
+		{Description: "Test PUT Endpoint with route param", Method: "PUT", Url: "/param/somevalue", Route: "/param/:value", RequestBody: `{"Status": "HELLO"}`, Status: 200, ResponseBody: `{"Status": "somevalue"}`},
+	}}
+
+	content, err := ToOpenApi("chitchat", rec)
+	if err != nil {
+		t.Fatalf("Cannot convert: %s", err.Error())
+	}
+	var openApi map[string]interface{}
+	json.Unmarshal(content, &openApi)
+	if _, ok := openApi["paths"].(map[string]interface{})["/param/{value}"]; !ok {
+		t.Errorf("Route should be converted to an OpenAPI path: %s", string(content))
+	}
+
+	content, err = ToPostman("chitchat", rec)
+	if err != nil || !strings.Contains(string(content), "{{baseUrl}}/param/somevalue") {
+		t.Errorf("Unexpected postman collection: %s", string(content))
+	}
+
+	content, err = ToHar(rec)
+	if err != nil || !strings.Contains(string(content), "https://www.example.com/param/somevalue") {
+		t.Errorf("Unexpected har: %s", string(content))
+	}
+}
+
+func TestDiffRecordings(t *testing.T) {
+	expected := &Recording{Exchanges: []Exchange{
+		{Name: "login", Method: "POST", Url: "/login", Status: 200, ResponseBody: `{"Status": "HELLO", "AuthToken": "a"}`},
+		{Method: "GET", Url: "/test", Route: "/test", Status: 200, ResponseBody: `{"Status": "OK"}`},
+	}}
+	actual := &Recording{Exchanges: []Exchange{
+		{Name: "login", Method: "POST", Url: "/login", Status: 200, ResponseBody: `{"Status": "HELLO", "AuthToken": "b"}`},
+		{Method: "GET", Url: "/other", Route: "/other", Status: 404},
+	}}
+
+	differences := DiffRecordings(expected, expected)
+	if len(differences) != 0 {
+		t.Errorf("Recording should not differ from itself: %v", differences)
+	}
+
+	differences = DiffRecordings(expected, actual)
+	if len(differences) != 3 {
+		t.Errorf("Should find 3 differences: %v", differences)
+	}
+	if differences[0] != `login: body.AuthToken: "a" != "b"` {
+		t.Errorf("Unexpected difference: %s", differences[0])
+	}
+}
+
+func TestMockEngine(t *testing.T) {
+	rec := &Recording{Exchanges: []Exchange{
+		{Method: "PUT", Url: "/param/somevalue", Route: "/param/:value", RequestBody: `{"Status": "HELLO"}`, Status: 200,
+			ResponseHeaders: map[string][]string{"Content-Type": {"application/json; charset=utf-8"}}, ResponseBody: `{"Status": "somevalue"}`},
+		{Method: "GET", Url: "/test", Route: "/test", Status: 200, ResponseBody: `{"Status": "OK"}`},
+	}}
+	mock := NewMockEngineWithOptions(rec, MockOptions{MatchBody: true})
+
+	w := PerformRequest(mock, HttpRequest{Method: "PUT", Path: "/param/othervalue", Body: gin.H{"Status": "HELLO"}})
+	AssertStatusCode(t, w, 200)
+	AssertResponseStatus(t, w, "somevalue")
+
+	w = PerformRequest(mock, HttpRequest{Method: "PUT", Path: "/param/othervalue", Body: gin.H{"Status": "BYE"}})
+	AssertStatusCode(t, w, 501)
+
+	w = PerformRequest(mock, HttpRequest{Method: "GET", Path: "/tests"})
+	AssertStatusCode(t, w, 501)
+	response := AssertResponseStatus(t, w, "Error")
+	if candidates := response["Candidates"].([]interface{}); len(candidates) != 2 || candidates[0] != "GET /test" {
+		t.Errorf("Nearest candidate should be listed first: %v", candidates)
+	}
+}
+
+func TestPlainHandlerRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(201)
+		w.Write([]byte(`{"Status": "Created"}`))
+	})
+	handler := MarkdownDebugMiddleware(ChiRoutes("GET /users/{id:[0-9]+}", "POST /users/{id:[0-9]+}/orders/{order}"))(mux)
+
+	w := PerformRequest(handler, HttpRequest{Method: "POST", Path: "/users/7/orders/abc", Description: "Test POST Endpoint of a plain http.Handler", Body: gin.H{"Status": "HELLO"}})
+	AssertStatusCode(t, w, 201)
+	AssertResponseStatus(t, w, "Created")
+
+	exchanges := Exchanges()
+	exchange := exchanges[len(exchanges)-1]
+	if exchange.Route != "/users/{id:[0-9]+}/orders/{order}" || exchange.PathParams["id"] != "7" || exchange.PathParams["order"] != "abc" || exchange.Status != 201 {
+		t.Errorf("Unexpected exchange: %v", exchange)
+	}
+
+	route, params, ok := ServeMuxRoutes(mux).ResolveRoute(httptest.NewRequest("GET", "/users/7", nil))
+	if !ok || route != "/users/" || len(params) != 0 {
+		t.Errorf("Unexpected ServeMux route: %s %v", route, params)
+	}
+
+	route, params, ok = GinRoutes(r).ResolveRoute(httptest.NewRequest("GET", "/users/1/orders/2", nil))
+	if !ok || route != "/users/:user/orders/:order" || params[1] != (PathParam{Key: "order", Value: "2"}) {
+		t.Errorf("Unexpected gin route: %s %v", route, params)
+	}
+}
+
+// Remote calls are documented with a fixed host and date, so the sample docs don't change between runs
+const testRemoteUrl = "http://remote.example.com"
+const testDate = "Mon, 19 Oct 2026 07:00:00 GMT"
+
+// dialTestServer sends requests for any host to a test server
+func dialTestServer(server *httptest.Server) *http.Transport {
+	return &http.Transport{DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}}
+}
+
+func TestRemoteRequest(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Header().Set("Date", testDate)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"Status": "OK"}`))
+	})
+	mux.HandleFunc("/cookie", func(w http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(cookie.Value))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewRemoteClient()
+	client.Client.Transport = dialTestServer(server)
+	client.Retries = 2
+	client.Backoff = time.Millisecond
+
+	res, err := client.Perform(context.Background(), HttpRequest{Method: "GET", Path: testRemoteUrl + "/flaky", Description: "Test remote GET Endpoint"})
+	if err != nil || res.StatusCode != 200 || res.Attempts != 3 || res.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("Unexpected remote response: %v %v", res, err)
+	}
+	var body map[string]interface{}
+	if err := res.Json(&body); err != nil || body["Status"] != "OK" {
+		t.Errorf("Unexpected remote body: %s", res.Body)
+	}
+
+	exchanges := Exchanges()
+	exchange := exchanges[len(exchanges)-1]
+	if exchange.Url != testRemoteUrl+"/flaky" || exchange.Route != "/flaky" || exchange.Status != 200 {
+		t.Errorf("Unexpected exchange: %v", exchange)
+	}
+
+	res, err = client.Perform(context.Background(), HttpRequest{Method: "GET", Path: testRemoteUrl + "/cookie"})
+	if err != nil || res.StatusCode != 200 || string(res.Body) != "abc" {
+		t.Errorf("Cookie should be kept: %v %v", res, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Perform(ctx, HttpRequest{Method: "GET", Path: testRemoteUrl + "/cookie"}); err == nil {
+		t.Errorf("Cancelled context should fail the request")
+	}
+
+	sent := 0
+	client.Client.Transport = failingTransport(func(req *http.Request) (*http.Response, error) {
+		sent++
+		return nil, errors.New("connection reset")
+	})
+	if _, err := client.Perform(context.Background(), HttpRequest{Method: "POST", Path: testRemoteUrl + "/charge", Description: "Test failing remote POST Endpoint", Body: gin.H{"Amount": 10}}); err == nil || sent != 1 {
+		t.Errorf("Transport errors should not be retried for POST: %d %v", sent, err)
+	}
+	exchanges = Exchanges()
+	if exchange := exchanges[len(exchanges)-1]; exchange.Description != "Test failing remote POST Endpoint" || !strings.Contains(exchange.Error, "connection reset") {
+		t.Errorf("The failed attempt should be documented: %v", exchange)
+	}
+	if _, err := client.Perform(context.Background(), HttpRequest{Method: "GET", Path: testRemoteUrl + "/charge"}); err == nil || sent != 4 {
+		t.Errorf("Transport errors should be retried for GET: %d %v", sent, err)
+	}
+
+	client.Client.Transport = failingTransport(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+	client.Backoff = time.Minute
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Perform(ctx, HttpRequest{Method: "GET", Path: testRemoteUrl + "/status", Description: "Test remote GET Endpoint timing out while retrying"}); err != context.DeadlineExceeded {
+		t.Errorf("Cancelling should end the retries: %v", err)
+	}
+	exchanges = Exchanges()
+	if exchange := exchanges[len(exchanges)-1]; exchange.Description != "Test remote GET Endpoint timing out while retrying" || exchange.Error != "context deadline exceeded" {
+		t.Errorf("The cancelled attempt should be documented: %v", exchange)
+	}
+}
+
+type failingTransport func(req *http.Request) (*http.Response, error)
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDownstreamCalls(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Date", testDate)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"Status": "Charged"}`))
+	}))
+	defer upstream.Close()
+
+	transport := NewRecordingTransport(dialTestServer(upstream))
+	client := &http.Client{Transport: transport}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checkout", func(w http.ResponseWriter, req *http.Request) {
+		charge, _ := http.NewRequest("POST", testRemoteUrl+"/charge/42", strings.NewReader(`{"Amount": 10}`))
+		res, err := client.Do(charge.WithContext(req.Context()))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"Status": "OK"}`))
+	})
+	handler := MarkdownDebugMiddleware()(mux)
+
+	w := PerformRequest(handler, HttpRequest{Method: "POST", Path: "/checkout", Description: "Test POST Endpoint calling another service", Body: gin.H{"Status": "HELLO"}})
+	AssertResponseStatus(t, w, "OK")
+
+	calls := AssertDownstreamCalls(t, transport, "POST", "/charge/:id", 1)
+	if len(calls) == 1 && (calls[0].Status != 200 || calls[0].RequestBody != `{"Amount": 10}`) {
+		t.Errorf("Unexpected downstream call: %v", calls[0])
+	}
+	AssertDownstreamCalls(t, transport, "GET", "/charge/:id", 0)
+
+	exchanges := Exchanges()
+	exchange := exchanges[len(exchanges)-1]
+	if len(exchange.DownstreamCalls) != 1 || exchange.DownstreamCalls[0].ResponseBody != `{"Status": "Charged"}` {
+		t.Errorf("Downstream call should be nested under the exchange: %v", exchange.DownstreamCalls)
+	}
+}
+
+// collectingT records the errors and cleanups of a helper instead of failing the test
+type collectingT struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (c *collectingT) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func (c *collectingT) Cleanup(cleanup func()) {
+	c.cleanups = append(c.cleanups, cleanup)
+}
+
+func (c *collectingT) finish() {
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+}
+
+func TestFakeUpstream(t *testing.T) {
+	collecting := &collectingT{TB: t}
+	upstream := NewFakeUpstream(collecting)
+	upstream.Expect("POST", "/charge/:id").WithBody(JsonBody(gin.H{"Amount": 10})).Respond(201, gin.H{"Status": "Charged"}).Times(1)
+	upstream.Expect("GET", "/slow").Delay(time.Second)
+	upstream.Expect("GET", "/broken").Fail()
+
+	client := NewRemoteClient()
+	res, err := client.Perform(context.Background(), HttpRequest{Method: "POST", Path: upstream.URL() + "/charge/42", Body: gin.H{"Amount": 10}})
+	if err != nil || res.StatusCode != 201 || res.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("Unexpected upstream response: %v %v", res, err)
+	}
+
+	client.Client.Timeout = 50 * time.Millisecond
+	if _, err := client.Perform(context.Background(), HttpRequest{Method: "GET", Path: upstream.URL() + "/slow"}); err == nil {
+		t.Errorf("Delayed response should time out")
+	}
+	if _, err := client.Perform(context.Background(), HttpRequest{Method: "GET", Path: upstream.URL() + "/broken"}); err == nil {
+		t.Errorf("Failing expectation should drop the connection")
+	}
+
+	// Expectations can be changed while calls are served
+	status := upstream.Expect("GET", "/status")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := http.Get(upstream.URL() + "/status"); err == nil {
+				res.Body.Close()
+			}
+		}()
+	}
+	status.Respond(200, gin.H{"Status": "OK"}).WithHeader("X-Version", "2")
+	wg.Wait()
+
+	upstream.Verify()
+	if len(collecting.errors) != 0 {
+		t.Errorf("All expectations should be met: %v", collecting.errors)
+	}
+
+	// Times(1) is used up, the second charge is unexpected and reported on cleanup despite the earlier Verify
+	res, _ = client.Perform(context.Background(), HttpRequest{Method: "POST", Path: upstream.URL() + "/charge/42", Body: gin.H{"Amount": 10}})
+	if res == nil || res.StatusCode != 501 {
+		t.Errorf("Unexpected call should be rejected: %v", res)
+	}
+	upstream.Verify()
+	collecting.finish()
+	if len(collecting.errors) != 1 || collecting.errors[0] != "Fake upstream: Unexpected call POST /charge/42\n" {
+		t.Errorf("Unexpected call should be reported once: %v", collecting.errors)
+	}
+
+	// Problems are told apart by expectation and call, not by message
+	collecting = &collectingT{TB: t}
+	upstream = NewFakeUpstream(collecting)
+	upstream.Expect("GET", "/rates").Times(3)
+	for i := 0; i < 2; i++ {
+		if res, err := http.Get(upstream.URL() + "/rates"); err == nil {
+			res.Body.Close()
+		}
+		upstream.Verify()
+	}
+	for i := 0; i < 2; i++ {
+		if res, err := http.Get(upstream.URL() + "/unknown"); err == nil {
+			res.Body.Close()
+		}
+	}
+	collecting.finish()
+	expected := []string{"Fake upstream: GET /rates was called 1 times, expected 3\n", "Fake upstream: Unexpected call GET /unknown\n", "Fake upstream: Unexpected call GET /unknown\n"}
+	if strings.Join(collecting.errors, "") != strings.Join(expected, "") {
+		t.Errorf("Every problem should be reported once: %v", collecting.errors)
+	}
+}
+
 func createRouter() *gin.Engine {
 	r := gin.Default()
 	r.Use(Cors())
@@ -70,6 +648,11 @@ func createRouter() *gin.Engine {
 			"Status": c.Param("value")})
 	})
 
+	r.GET("/users/:user/orders/:order", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"Status": c.Param("user") + "/" + c.Param("order")})
+	})
+
 	r.PUT("/param/:value", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"Status": c.Param("value")})
@@ -246,6 +829,313 @@ func TestSelectStatementWithJoin(t *testing.T) {
 	t.Logf("In Args: %v\n", inArgs)
 }
 
+func TestSelectStatementWithTypedJoins(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Select("users").As("u").Returning("u.name", "o.amount", "p.provider").
+		InnerJoin("orders", "o", ColumnsEqual("o.user_id", "u.id")).On(Equal("o.status", "paid")).
+		LeftJoin("payments", "p", ColumnsEqual("p.order_id", "o.id"), Cond("p.amount", ">", 10)).
+		WhereArg("u.active", true).OrderBy("o.amount", "DESC").Build()
+
+	if err != nil {
+		t.Errorf("Cannot create query: %s", err.Error())
+	}
+	if query != "SELECT u.name, o.amount, p.provider FROM users u INNER JOIN orders o ON o.user_id=u.id AND o.status=$1 LEFT JOIN payments p ON p.order_id=o.id AND p.amount>$2 WHERE u.active=$3 ORDER BY o.amount DESC" {
+		t.Errorf("Mismatching query: %s\n", query)
+	}
+	if len(inArgs) != 3 || inArgs[0] != "paid" || inArgs[2] != true {
+		t.Errorf("Unexpected arguments: %v", inArgs)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, _, _, err = sb.QuotedIdentifiers().Select("user").As("u").Returning("u.id").Join("join a on a.id=u.id").Join("join b on b.id=u.id").All().Build()
+	if err != nil || query != `SELECT "u"."id" FROM "user" "u" join a on a.id=u.id join b on b.id=u.id WHERE 1=1` {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err = sb.Select("users").Returning("id").LeftJoin("orders", "o").All().Build(); err == nil {
+		t.Errorf("Joins without conditions should fail")
+	}
+}
+
+func TestSelectStatementWithGroupBy(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, outArgs, err := sb.Select("orders").Returning("customerid", Count("", "orders"), Sum("amount", "total"), Avg("amount", ""), Min("created", "first"), Max("created", "last")).
+		WhereArg("status", "paid").GroupBy("customerid").Having(Cond(Sum("amount", ""), ">", 100)).OrderBy("total", "DESC").Limit(10).Build()
+
+	if err != nil {
+		t.Errorf("Cannot create query: %s", err.Error())
+	}
+	if query != "SELECT customerid, count(*) AS orders, sum(amount) AS total, avg(amount), min(created) AS first, max(created) AS last FROM orders WHERE status=$1 GROUP BY customerid HAVING sum(amount)>$2 ORDER BY total DESC LIMIT 10" {
+		t.Errorf("Mismatching query: %s\n", query)
+	}
+	if len(inArgs) != 2 || inArgs[1] != 100 || strings.Join(outArgs, ",") != "customerid,orders,total,avg(amount),first,last" {
+		t.Errorf("Unexpected arguments: %v %v", inArgs, outArgs)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Select("orders").Returning(Count("", "")).All().Having(Cond(Count("", ""), ">", 1)).Build()
+	if err != nil || query != "SELECT count(*) FROM orders WHERE 1=1 HAVING count(*)>$1" || len(inArgs) != 1 {
+		t.Errorf("Having without GroupBy applies to the whole table: %s %v\n", query, err)
+	}
+
+	db, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"count"}, [][]driver.Value{{int64(3)}}
+	})
+	if count, err := CountRows(db, "orders", Equal("status", "paid"), IsNull("deleted")); err != nil || count != 3 {
+		t.Errorf("Unexpected count: %d %v", count, err)
+	}
+	if statements := database.Statements(); statements[0].query != "SELECT count(*) FROM orders WHERE status=$1 AND deleted IS NULL" {
+		t.Errorf("Unexpected count query: %s", statements[0].query)
+	}
+}
+
+func TestSelectStatementWithPagination(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, _, _, err := sb.Select("users").Returning("id").All().OrderBy("id", "ASC").Limit(20).Offset(40).Build()
+	if err != nil || query != "SELECT id FROM users WHERE 1=1 ORDER BY id ASC LIMIT 20 OFFSET 40" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	cursor, err := EncodeCursor("2020-01-01", 42)
+	if err != nil {
+		t.Fatalf("Cannot encode cursor: %s", err.Error())
+	}
+	values, err := DecodeCursor(cursor)
+	if err != nil || len(values) != 2 || values[0] != "2020-01-01" || values[1] != int64(42) {
+		t.Fatalf("Unexpected cursor values: %v %v", values, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, inArgs, outArgs, err := sb.Select("users").As("u").Returning("u.id", "u.created").WhereArg("u.active", true).
+		OrderBy("u.created", "DESC").OrderBy("u.id", "DESC").SeekAfter(values...).WithTotalCount("total").Limit(20).Build()
+	if err != nil || query != "SELECT u.id, u.created, count(*) OVER () AS total FROM users u WHERE u.active=$1 AND (u.created, u.id)<($2, $3) ORDER BY u.created DESC, u.id DESC LIMIT 20" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+	if len(inArgs) != 3 || inArgs[2] != int64(42) || len(outArgs) != 3 || outArgs[2] != "total" {
+		t.Errorf("Unexpected arguments: %v %v", inArgs, outArgs)
+	}
+	if next, err := sb.CursorFor(map[string]interface{}{"id": int64(42), "created": []byte("2020-01-01")}); err != nil || next != cursor {
+		t.Errorf("Cursor should be taken from the order columns: %s %v", next, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Select("users").Returning("id").OrderBy("name", "asc").OrderBy("id", "desc").SeekAfter("Bob", 7).Build()
+	if err != nil || query != "SELECT id FROM users WHERE (name>$1 OR (name=$2 AND id<$3)) ORDER BY name asc, id desc" || len(inArgs) != 3 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	// Unfiltered lists
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Select("u").Returning("id").All().OrderBy("a", "ASC").OrderBy("b", "DESC").SeekAfter(1, 2).Build()
+	if err != nil || query != "SELECT id FROM u WHERE (a>$1 OR (a=$2 AND b<$3)) ORDER BY a ASC, b DESC" || len(inArgs) != 3 {
+		t.Errorf("The keyset should apply to selects using All: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, _, _, err = sb.Select("users").WithTotalCount("total").Returning("id").All().Build()
+	if err != nil || query != "SELECT id, count(*) OVER () AS total FROM users WHERE 1=1" {
+		t.Errorf("The total count should survive Returning: %s %v\n", query, err)
+	}
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err := sb.Select("users").Returning("id").All().WithTotalCount("t FROM secrets --").Build(); err == nil {
+		t.Errorf("Total count aliases should be identifiers")
+	}
+
+	if _, err := DecodeCursor("not a cursor"); err == nil {
+		t.Errorf("Malformed cursors should be rejected")
+	}
+}
+
+func TestSelectStatementWithSubqueries(t *testing.T) {
+	paid := PostgresSqlBuilder{}
+	paid.Select("orders").Returning("customerid").WhereArg("status", "paid")
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Select("customers").Returning("id").WhereArg("active", true).WhereIn("id", &paid).Build()
+	if err != nil || query != "SELECT id FROM customers WHERE active=$1 AND id IN (SELECT customerid FROM orders WHERE status=$2)" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+	if len(inArgs) != 2 || inArgs[1] != "paid" {
+		t.Errorf("Unexpected arguments: %v", inArgs)
+	}
+
+	orders := PostgresSqlBuilder{}
+	orders.Select("orders").Returning("id").WhereExpr(ColumnsEqual("orders.customerid", "c.id"), Cond("amount", ">", 100))
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Select("customers").As("c").Returning("c.id").WhereArg("c.region", "EU").WhereExpr(Exists(&orders)).Build()
+	if err != nil || query != "SELECT c.id FROM customers c WHERE c.region=$1 AND EXISTS (SELECT id FROM orders WHERE orders.customerid=c.id AND amount>$2)" || len(inArgs) != 2 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	totals := PostgresSqlBuilder{}
+	totals.Select("orders").Returning("customerid", Sum("amount", "total")).WhereArg("status", "paid").GroupBy("customerid")
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.With("totals", &totals).SelectFrom(&totals, "t").Returning("t.customerid").WhereExpr(Cond("t.total", ">", 100)).Build()
+	if err != nil || query != "WITH totals AS (SELECT customerid, sum(amount) AS total FROM orders WHERE status=$1 GROUP BY customerid) "+
+		"SELECT t.customerid FROM (SELECT customerid, sum(amount) AS total FROM orders WHERE status=$2 GROUP BY customerid) t WHERE t.total>$3" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+	if len(inArgs) != 3 || inArgs[2] != 100 {
+		t.Errorf("Unexpected arguments: %v", inArgs)
+	}
+
+	root := PostgresSqlBuilder{}
+	children := PostgresSqlBuilder{}
+	children.Select("categories").As("c").Returning("c.id").InnerJoin("tree", "t", ColumnsEqual("c.parentid", "t.id")).All()
+	root.Select("categories").Returning("id").WhereArg("id", 1).UnionAll(&children)
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.WithRecursive("tree(id)", &root).Select("tree").Returning("id").All().Build()
+	if err != nil || query != "WITH RECURSIVE tree(id) AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c INNER JOIN tree t ON c.parentid=t.id WHERE 1=1) SELECT id FROM tree WHERE 1=1" || len(inArgs) != 1 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err := sb.Select("users").Returning("id").WhereIn("id", &sb).Build(); err == nil {
+		t.Errorf("A builder should not be its own subquery")
+	}
+}
+
+func TestSelectStatementSafeMode(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Safe().Select("users").As("u").Returning("u.id", Count("", "total")).WhereArgRelationship("u.name", "like", "A%").
+		WhereExpr(Cond("u.created", "<", Raw("now()"))).GroupBy("u.id").OrderBy("u.name", "desc  nulls last").Build()
+	if err != nil || query != "SELECT u.id, count(*) AS total FROM users u WHERE u.name LIKE $1 AND u.created<now() GROUP BY u.id ORDER BY u.name desc nulls last" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+	if len(inArgs) != 1 {
+		t.Errorf("Raw values should not be bound: %v", inArgs)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, _, _, err = sb.Safe().Select("orders").Returning(Sum("amount", "total")).All().Having(Cond(Max("amount", ""), ">", 100)).Build()
+	if err != nil || query != `SELECT sum("amount") AS total FROM orders WHERE 1=1 HAVING max("amount")>$1` {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	unsafe := []func(sb *SqlBuilder) *SqlBuilder{
+		func(sb *SqlBuilder) *SqlBuilder { return sb.Select("users; DROP TABLE users").Returning("id").All() },
+		func(sb *SqlBuilder) *SqlBuilder { return sb.Select("users").Returning("id, password").All() },
+		func(sb *SqlBuilder) *SqlBuilder { return sb.Select("users").As("u --").Returning("id").All() },
+		func(sb *SqlBuilder) *SqlBuilder {
+			return sb.Select("users").Returning("id").WhereArg("1=1 OR id", 1)
+		},
+		func(sb *SqlBuilder) *SqlBuilder {
+			return sb.Select("users").Returning("id").All().OrderBy("(SELECT 1)", "ASC")
+		},
+		func(sb *SqlBuilder) *SqlBuilder {
+			inner := PostgresSqlBuilder{}
+			inner.Select("orders").Returning("user_id").WhereArg("amount > 0 OR user_id", 1)
+			return sb.Select("users").Returning("id").WhereIn("id", &inner)
+		},
+	}
+	for i, build := range unsafe {
+		sb := PostgresSqlBuilder{}
+		if query, _, _, err := build(sb.Safe()).Build(); err == nil {
+			t.Errorf("Statement %d should be rejected in safe mode: %s", i, query)
+		}
+	}
+
+	quoted := []func(sb *SqlBuilder) *SqlBuilder{
+		func(sb *SqlBuilder) *SqlBuilder { return sb.Select("users; DROP TABLE x --").Returning("id").All() },
+		func(sb *SqlBuilder) *SqlBuilder {
+			return sb.Select("users").Returning("id").WhereArg("name = name OR 1", 1)
+		},
+		func(sb *SqlBuilder) *SqlBuilder {
+			return sb.Select("users").Returning("id").All().OrderBy("(SELECT password)", "ASC")
+		},
+	}
+	for i, build := range quoted {
+		sb := PostgresSqlBuilder{}
+		if query, _, _, err := build(sb.QuotedIdentifiers()).Build(); err == nil {
+			t.Errorf("Statement %d should be rejected with quoted identifiers: %s", i, query)
+		}
+	}
+	sb = PostgresSqlBuilder{}
+	if query, _, _, err := sb.QuotedIdentifiers().Select("users").Returning("*", Count("u.id", "total")).All().Build(); err != nil || query != `SELECT *, count("u"."id") AS total FROM "users" WHERE 1=1` {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err := sb.Select("users").Returning("id").WhereArgRelationship("id", "= 1 OR 1 =", 5).Build(); err == nil {
+		t.Errorf("Relationships outside of the allow-list should be rejected")
+	}
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err := sb.Select("users").Returning("id").All().OrderBy("id", "ASC, password").Build(); err == nil {
+		t.Errorf("Directions other than ASC and DESC should be rejected")
+	}
+}
+
+func TestSelectStatementClone(t *testing.T) {
+	base := PostgresSqlBuilder{}
+	base.Select("users").As("u").Returning("u.id", "u.name").WhereArg("u.tenantid", 7).
+		InnerJoin("teams", "t", ColumnsEqual("t.id", "u.teamid"))
+
+	first, firstArgs, _, err := base.Build()
+	second, secondArgs, _, _ := base.Build()
+	if err != nil || first != second || len(firstArgs) != 1 || len(secondArgs) != 1 {
+		t.Errorf("Build should be idempotent: %s %v / %s %v %v", first, firstArgs, second, secondArgs, err)
+	}
+
+	active := base.Clone().WhereArg("u.active", true).OrderBy("u.name", "ASC").Limit(10)
+	active.On(Equal("t.visible", true))
+	query, inArgs, _, err := active.Build()
+	if err != nil || query != "SELECT u.id, u.name FROM users u INNER JOIN teams t ON t.id=u.teamid AND t.visible=$1 WHERE u.tenantid=$2 AND u.active=$3 ORDER BY u.name ASC LIMIT 10" || len(inArgs) != 3 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	query, inArgs, _, err = base.Clone().WhereIn("u.id", []int{1, 2}).Build()
+	if err != nil || query != "SELECT u.id, u.name FROM users u INNER JOIN teams t ON t.id=u.teamid WHERE u.tenantid=$1 AND u.id IN ($2, $3)" || len(inArgs) != 3 {
+		t.Errorf("Clones should not share conditions: %s %v\n", query, err)
+	}
+	if again, _, _, _ := base.Build(); again != first {
+		t.Errorf("The base query should not change: %s", again)
+	}
+
+	upsert := PostgresSqlBuilder{}
+	upsert.Insert("users").SetArg("email", "a@b.c").OnConflict("email").DoUpdateSetExcluded("email")
+	clone := upsert.Clone().DoUpdateSetArg("name", "A")
+	query, _, _, _ = upsert.Build()
+	cloned, _, _, _ := clone.Build()
+	if query == cloned || strings.Contains(query, "name") {
+		t.Errorf("Conflict handling should be copied: %s / %s", query, cloned)
+	}
+
+	// Clones share the subquery of the base, run with -race to check they only read it
+	paid := PostgresSqlBuilder{}
+	paid.Select("orders").Returning("id").WhereExpr(ColumnsEqual("orders.userid", "u.id"), Equal("orders.status", "paid"))
+	customers := PostgresSqlBuilder{}
+	customers.Select("users").As("u").Returning("u.id").WhereExpr(Exists(&paid)).WhereIn("u.teamid", &paid)
+	var wg sync.WaitGroup
+	queries := make([]string, 8)
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query, _, _, err := customers.Clone().WhereArg("u.tenantid", i).Build()
+			if err != nil {
+				t.Errorf("Cannot build clone: %s", err.Error())
+			}
+			queries[i] = query
+		}(i)
+	}
+	wg.Wait()
+	for _, query := range queries {
+		if query != "SELECT u.id FROM users u WHERE u.tenantid=$1 AND EXISTS (SELECT id FROM orders WHERE orders.userid=u.id AND orders.status=$2) "+
+			"AND u.teamid IN (SELECT id FROM orders WHERE orders.userid=u.id AND orders.status=$3)" {
+			t.Errorf("Mismatching query: %s\n", query)
+		}
+	}
+
+	broken := PostgresSqlBuilder{}
+	broken.Select("users").Returning("id")
+	if _, _, _, err := broken.Build(); err == nil {
+		t.Errorf("A select without conditions should fail")
+	}
+	if query, _, _, err := broken.All().Build(); err != nil || query != "SELECT id FROM users WHERE 1=1" {
+		t.Errorf("Errors of a previous Build should not stick: %s %v", query, err)
+	}
+}
+
 func TestSelectStatementError(t *testing.T) {
 	sb := PostgresSqlBuilder{}
 	_, _, _, err := sb.Select("").Returning("firstname", "lastname").WhereArg("customerid", 5).WhereArg("accounttype", "seller").WhereArg("active", true).Build()
@@ -268,6 +1158,72 @@ func TestSelectStatementError(t *testing.T) {
 
 }
 
+func TestSelectStatementWithConditions(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Select("orders").Returning("id").WhereArg("customerid", 5).
+		WhereExpr(Cond("created", ">=", "2020-01-01"), Cond("created", "<", "2020-02-01")).
+		WhereExpr(Or(Equal("status", "new"), And(Equal("status", "paid"), Not(Equal("refunded", true))))).Build()
+
+	if err != nil {
+		t.Errorf("Cannot create query: %s", err.Error())
+	}
+	if query != "SELECT id FROM orders WHERE customerid=$1 AND created>=$2 AND created<$3 AND (status=$4 OR (status=$5 AND NOT (refunded=$6)))" {
+		t.Errorf("Mismatching query: %s\n", query)
+	}
+	if len(inArgs) != 6 || inArgs[2] != "2020-02-01" || inArgs[5] != true {
+		t.Errorf("Unexpected arguments: %v", inArgs)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Update("orders").SetArg("status", "cancelled").WhereExpr(Or(Equal("id", 1), Equal("id", 2))).Build()
+	if err != nil || query != "UPDATE orders SET status=$1 WHERE (id=$2 OR id=$3)" || len(inArgs) != 3 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err = sb.Insert("orders").SetArg("id", 1).WhereExpr(Equal("id", 1)).Build(); err == nil {
+		t.Errorf("Conditions should not be accepted for inserts")
+	}
+
+	// All() drops the need for a WHERE clause, not the conditions
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Select("u").Returning("id").All().WhereExpr(Equal("a", 1)).WhereNull("b").Build()
+	if err != nil || query != "SELECT id FROM u WHERE a=$1 AND b IS NULL" || len(inArgs) != 1 {
+		t.Errorf("Conditions should apply together with All: %s %v\n", query, err)
+	}
+}
+
+func TestSelectStatementWithPredicates(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Select("users").Returning("id").WhereIn("id", []int{1, 2, 3}).WhereNotIn("role", []string{"admin"}).
+		WhereNull("deleted").WhereNotNull("email").WhereBetween("age", 18, 65).WhereILike("name", ContainsPattern("50%_off")).Build()
+
+	if err != nil {
+		t.Errorf("Cannot create query: %s", err.Error())
+	}
+	if query != "SELECT id FROM users WHERE id IN ($1, $2, $3) AND role NOT IN ($4) AND deleted IS NULL AND email IS NOT NULL AND age BETWEEN $5 AND $6 AND name ILIKE $7" {
+		t.Errorf("Mismatching query: %s\n", query)
+	}
+	if len(inArgs) != 7 || inArgs[6] != `%50\%\_off%` {
+		t.Errorf("Unexpected arguments: %v", inArgs)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, inArgs, _, err = sb.Delete("users").WhereExpr(AnyOf("id", []int{1, 2}), In("role", []string{})).Build()
+	if err != nil || query != "DELETE FROM users WHERE id = ANY($1) AND 1=0" || len(inArgs) != 1 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	query, _, _, err = NewSqlBuilder(Sqlite).Update("users").SetArg("active", false).WhereILike("email", SuffixPattern("@example.com")).Build()
+	if err != nil || query != `UPDATE users SET active=? WHERE LOWER(email) LIKE LOWER(?) ESCAPE '\'` {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	if _, _, _, err = NewSqlBuilder(MySql).Select("users").Returning("id").WhereExpr(AnyOf("id", []int{1})).Build(); err == nil {
+		t.Errorf("ANY should only be accepted by Postgres")
+	}
+}
+
 func TestInsertStatement(t *testing.T) {
 	sb := PostgresSqlBuilder{}
 	query, inArgs, outArgs, err := sb.Insert("mytable").Returning("id").SetArg("lifetimevalue", 100).SetArg("customerid", 5).SetArg("accounttype", "seller").SetArg("active", true).SetExplicitArg("geom", "ST_SetSRID(ST_MakePoint(-120, 80), 4326)").Build()
@@ -291,6 +1247,94 @@ func TestInsertStatement(t *testing.T) {
 	t.Logf("In Args: %v\n", inArgs)
 }
 
+func TestInsertManyStatement(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, outArgs, err := sb.InsertMany("users", []string{"name", "age"}, [][]interface{}{{"Alice", 30}, {"Bob", 40}}).Returning("id").Build()
+	if err != nil || query != "INSERT INTO users (name, age) VALUES ($1, $2), ($3, $4) RETURNING id" || len(inArgs) != 4 || len(outArgs) != 1 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	rows := make([][]interface{}, 50000)
+	for i := range rows {
+		rows[i] = []interface{}{i, "name", true}
+	}
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err = sb.InsertMany("users", []string{"id", "name", "active"}, rows).Build(); err == nil {
+		t.Errorf("150000 arguments should not fit into one statement")
+	}
+	sb = PostgresSqlBuilder{}
+	statements, err := sb.InsertMany("users", []string{"id", "name", "active"}, rows).BuildBatches()
+	if err != nil || len(statements) != 3 || len(statements[0].Args) != 65535 || statements[2].Args[len(statements[2].Args)-3] != 49999 {
+		t.Errorf("Unexpected batches: %d %v", len(statements), err)
+	}
+	if !strings.HasSuffix(statements[2].Query, "($18928, $18929, $18930)") {
+		t.Errorf("Placeholders should be numbered per batch: %s", statements[2].Query[len(statements[2].Query)-40:])
+	}
+
+	// Arguments of the conflict handling take room from the rows
+	sb = PostgresSqlBuilder{}
+	statements, err = sb.InsertMany("users", []string{"id", "name", "active"}, rows).
+		OnConflict("id").DoUpdateSetArg("name", "Anonymous").DoUpdateWhere(Cond("users.locked", "=", false)).BuildBatches()
+	if err != nil || len(statements) != 3 || len(statements[0].Args) != 65534 || len(statements[0].Args)+len(statements[1].Args)+len(statements[2].Args) != 150006 {
+		t.Errorf("Unexpected batches with conflict handling: %d %v", len(statements), err)
+	}
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err := sb.InsertMany("users", []string{"id", "name", "active"}, rows[:21845]).OnConflict("id").DoUpdateSetArg("name", "Anonymous").Build(); err == nil {
+		t.Errorf("Arguments of the conflict handling should count towards the limit")
+	}
+
+	db, database := openFakeDb(t, nil)
+	sb = PostgresSqlBuilder{}
+	if _, err := sb.InsertMany("users", []string{"id", "name", "active"}, nil).BulkInsert(db, RowsOf(rows)); err != nil {
+		t.Errorf("Cannot bulk insert: %s", err.Error())
+	}
+	if statements := database.Statements(); len(statements) != 3 || len(statements[2].args) != 18930 {
+		t.Errorf("Unexpected bulk statements: %d", len(statements))
+	}
+
+	db, database = openFakeDb(t, nil)
+	sb = PostgresSqlBuilder{}
+	if _, err := sb.QuotedIdentifiers().InsertMany("users", []string{"id", "name", "active"}, nil).OnConflict("id").DoNothing().BulkInsert(db, RowsOf(rows[:2])); err != nil {
+		t.Errorf("Cannot bulk insert: %s", err.Error())
+	}
+	if statements := database.Statements(); len(statements) != 1 || statements[0].query != `INSERT INTO "users" ("id", "name", "active") VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT ("id") DO NOTHING` {
+		t.Errorf("Conflict handling and quoting should apply to bulk statements: %v", statements)
+	}
+	sb = PostgresSqlBuilder{}
+	if _, err := sb.InsertMany("users", []string{"id"}, nil).Returning("id").BulkInsert(db, RowsOf(rows)); err == nil {
+		t.Errorf("Returned rows can not be read by BulkInsert")
+	}
+}
+
+func TestUpsertStatement(t *testing.T) {
+	sb := PostgresSqlBuilder{}
+	query, inArgs, _, err := sb.Insert("users").SetArg("email", "a@example.com").SetArg("name", "Alice").
+		OnConflict("email").DoUpdateSetExcluded("name").DoUpdateSetArg("visits", 1).DoUpdateWhere(Cond("users.locked", "=", false)).Returning("id").Build()
+	if err != nil || query != "INSERT INTO users (email, name) VALUES ($1, $2) ON CONFLICT (email) DO UPDATE SET name=EXCLUDED.name, visits=$3 WHERE users.locked=$4 RETURNING id" || len(inArgs) != 4 {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	query, _, _, err = sb.InsertMany("tags", []string{"name"}, [][]interface{}{{"a"}, {"b"}}).OnConflict("name").OnConflictWhere(IsNull("deleted")).DoNothing().Build()
+	if err != nil || query != "INSERT INTO tags (name) VALUES ($1), ($2) ON CONFLICT (name) WHERE deleted IS NULL DO NOTHING" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	query, _, _, err = NewSqlBuilder(MySql).Insert("users").SetArg("email", "a@example.com").SetArg("name", "Alice").OnConflict("email").DoUpdateSetExcluded("name").Build()
+	if err != nil || query != "INSERT INTO users (email, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE name=VALUES(name)" {
+		t.Errorf("Mismatching query: %s %v\n", query, err)
+	}
+
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err = sb.Insert("users").SetArg("email", "a@example.com").OnConflict("email").Build(); err == nil {
+		t.Errorf("OnConflict without an action should fail")
+	}
+	sb = PostgresSqlBuilder{}
+	if _, _, _, err = sb.Select("users").Returning("id").All().OnConflict("email").Build(); err == nil {
+		t.Errorf("OnConflict should only be accepted for inserts")
+	}
+}
+
 func TestUpdateStatement(t *testing.T) {
 	sb := PostgresSqlBuilder{}
 	query, inArgs, outArgs, err := sb.Update("mytable").Returning("id").SetArg("lifetimevalue", 100).SetArg("active", false).SetExplicitArg("geom", "ST_SetSRID(ST_MakePoint(-120, 80), 4326)").WhereArg("customerid", 5).WhereArg("accounttype", "seller").WhereArg("active", true).Build()
@@ -382,3 +1426,433 @@ func TestDeleteStatementNoReturning(t *testing.T) {
 
 	t.Logf("In Args: %v\n", inArgs)
 }
+
+func TestLoadFixtures(t *testing.T) {
+	nextId := int64(0)
+	db, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema") {
+			return []string{"table_name", "table_name"}, nil
+		}
+		nextId++
+		return []string{"id"}, [][]driver.Value{{nextId}}
+	})
+
+	fixtures, err := ParseFixtures([]byte(`
+orders:
+  - user_id: "{{users.alice.id}}"
+    note: "order of {{users.alice.id}}"
+    items: [{sku: A1}]
+users:
+  - _ref: alice
+    name: Alice
+  - name: Bob
+    manager_id: "{{users.alice.id}}"
+`))
+	if err != nil {
+		t.Fatalf("Cannot parse fixtures: %s", err.Error())
+	}
+	if err := fixtures.Insert(db); err != nil {
+		t.Fatalf("Cannot insert fixtures: %s", err.Error())
+	}
+
+	statements := database.Statements()[1:]
+	if len(statements) != 3 ||
+		statements[0].query != "INSERT INTO users (name) VALUES ($1) RETURNING id" ||
+		statements[1].query != "INSERT INTO users (name, manager_id) VALUES ($1, $2)" || statements[1].args[1] != int64(1) ||
+		statements[2].query != "INSERT INTO orders (user_id, note, items) VALUES ($1, $2, $3)" ||
+		statements[2].args[1] != "order of 1" || statements[2].args[2] != `[{"sku":"A1"}]` {
+		t.Errorf("Unexpected statements: %v", statements)
+	}
+
+	if path := PopulateVariables("/users/{{users.alice.id}}"); path != "/users/1" {
+		t.Errorf("Captured id should be available to requests: %s", path)
+	}
+
+	circular, _ := ParseFixtures([]byte(`
+a:
+  - b_id: "{{b.x.id}}"
+b:
+  - a_id: "{{a.x.id}}"
+`))
+	if err := circular.Insert(db); err == nil {
+		t.Errorf("Circular references should fail")
+	}
+
+	// Foreign keys without references are read from the catalog
+	db, database = openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema") {
+			return []string{"table_name", "table_name"}, [][]driver.Value{{"orders", "users"}, {"users", "users"}, {"payments", "orders"}}
+		}
+		return []string{"id"}, [][]driver.Value{{int64(1)}}
+	})
+	ordered, _ := ParseFixtures([]byte(`
+orders:
+  - user_id: 1
+users:
+  - _ref: alice
+    id: 1
+`))
+	if err := ordered.Insert(db); err != nil {
+		t.Fatalf("Cannot insert fixtures: %s", err.Error())
+	}
+	if statements := database.Statements(); len(statements) != 3 || !strings.Contains(statements[0].query, "FOREIGN KEY") || statements[1].query != "INSERT INTO users (id) VALUES ($1) RETURNING id" {
+		t.Errorf("Referenced tables should be inserted first: %v", statements)
+	}
+
+	// DependsOn overrides the catalog
+	db, database = openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema") {
+			return []string{"table_name", "table_name"}, [][]driver.Value{{"users", "orders"}}
+		}
+		return []string{"id"}, [][]driver.Value{{int64(1)}}
+	})
+	ordered.DependsOn = map[string][]string{"orders": {"users", "products"}, "users": {}}
+	if err := ordered.Insert(db); err != nil {
+		t.Fatalf("Cannot insert fixtures: %s", err.Error())
+	}
+	if statements := database.Statements(); len(statements) != 3 || statements[1].query != "INSERT INTO users (id) VALUES ($1) RETURNING id" {
+		t.Errorf("Dependencies should be inserted first: %v", statements)
+	}
+
+	// Fixtures may be loaded by parallel tests
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ordered.Insert(db)
+			PopulateVariables("/users/{{users.alice.id}}")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBeginTestTransaction(t *testing.T) {
+	db, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"count"}, [][]driver.Value{{int64(2)}}
+	})
+
+	t.Run("isolated", func(t *testing.T) {
+		tx := BeginTestTransaction(t, db)
+		builder := PostgresSqlBuilder{}
+		if _, err := builder.Insert("users").SetArg("name", "Alice").Exec(tx); err != nil {
+			t.Errorf("Cannot insert: %s", err.Error())
+		}
+		if count, err := CountRows(tx, "users"); err != nil || count != 2 {
+			t.Errorf("Unexpected count: %d %v", count, err)
+		}
+
+		t.Run("nested", func(t *testing.T) {
+			BeginTestTransaction(t, tx)
+		})
+	})
+
+	statements := database.Statements()
+	expected := []string{
+		"BEGIN",
+		"INSERT INTO users (name) VALUES ($1)",
+		"SELECT count(*) FROM users WHERE 1=1",
+		"SAVEPOINT httptesting_",
+		"ROLLBACK TO SAVEPOINT httptesting_",
+		"ROLLBACK",
+	}
+	if len(statements) != len(expected) {
+		t.Fatalf("Unexpected statements: %v", statements)
+	}
+	for i, statement := range statements {
+		if !strings.HasPrefix(statement.query, expected[i]) {
+			t.Errorf("Unexpected statement %d: %s, expected %s", i, statement.query, expected[i])
+		}
+	}
+}
+
+func TestDatabaseAssertions(t *testing.T) {
+	db, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if len(args) > 0 && args[len(args)-1] == "nobody@example.com" {
+			return []string{"id", "name"}, nil
+		}
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), []byte("Alice")}, {int64(2), []byte("Bob")}}
+	})
+
+	AssertRowCount(t, db, "users", nil, 2)
+	AssertRowExists(t, db, "users", map[string]interface{}{"name": "Alice", "active": true})
+	AssertNoRow(t, db, "users", map[string]interface{}{"email": "nobody@example.com"})
+	if row := AssertRow(t, db, "users", map[string]interface{}{"active": true}, map[string]interface{}{"id": 2, "name": "Bob"}); row == nil {
+		t.Errorf("Matching row should be returned")
+	}
+
+	AssertRowExists(t, db, "sessions", map[string]interface{}{"revoked_at": nil, "user_id": 1})
+
+	statements := database.Statements()
+	if statements[0].query != "SELECT * FROM users WHERE 1=1" || statements[1].query != "SELECT * FROM users WHERE active=$1 AND name=$2" {
+		t.Errorf("Unexpected statements: %v", statements)
+	}
+	if last := statements[len(statements)-1]; last.query != "SELECT * FROM sessions WHERE user_id=$1 AND revoked_at IS NULL" || len(last.args) != 1 {
+		t.Errorf("Nil values should match NULL columns: %v", last)
+	}
+
+	rows := []map[string]interface{}{{"id": int64(1), "name": []byte("Alice")}}
+	if rowMatches(rows[0], map[string]interface{}{"name": "Bob"}) || describeRows(rows) != "\n\tid=1, name=Alice" {
+		t.Errorf("Unexpected row description: %s", describeRows(rows))
+	}
+}
+
+func TestDocumentDatabaseChanges(t *testing.T) {
+	snapshots := [][][]driver.Value{
+		{{int64(1), []byte("Alice")}, {int64(2), []byte("Bob")}},
+		{{int64(1), []byte("Alicia")}, {int64(3), []byte("Carol")}},
+	}
+	db, _ := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		rows := snapshots[0]
+		snapshots = snapshots[1:]
+		return []string{"id", "name"}, rows
+	})
+
+	DocumentDatabaseChanges(db, "users")
+	defer DocumentDatabaseChanges(nil)
+
+	// The fake database does not belong in the sample docs, the request is left undocumented and snapshotted here
+	before := snapshotTables()
+	w := PerformRequest(r, HttpRequest{Method: "GET", Path: "/test"})
+	AssertStatusCode(t, w, 200)
+
+	changes := diffSnapshots(before, snapshotTables())
+	if len(changes) != 1 || len(changes[0].Inserted) != 1 || len(changes[0].Updated) != 1 || len(changes[0].Deleted) != 1 ||
+		changes[0].Inserted[0]["name"] != "Carol" || changes[0].Updated[0].After["name"] != "Alicia" || changes[0].Deleted[0]["id"] != int64(2) {
+		t.Fatalf("Unexpected database changes: %v", changes)
+	}
+
+	if markdown := markdownDatabaseChanges(changes); !strings.Contains(markdown, "| 1 | Alice → Alicia |") || !strings.Contains(markdown, "`users` deleted:") {
+		t.Errorf("Unexpected markdown: %s", markdown)
+	}
+
+	// Composite keys, only the rows of one group are read
+	snapshots = [][][]driver.Value{
+		{{int64(7), int64(1), []byte("a|b")}, {int64(7), int64(2), []byte("member")}},
+		{{int64(7), int64(1), []byte("admin")}, {int64(7), int64(2), []byte("member")}},
+	}
+	db, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		rows := snapshots[0]
+		snapshots = snapshots[1:]
+		return []string{"groupid", "userid", "role"}, rows
+	})
+	DocumentTableChanges(db, WatchedTable{Name: "memberships", Key: []string{"groupid", "userid"}, Where: []Condition{Equal("groupid", 7)}})
+
+	changes = diffSnapshots(snapshotTables(), snapshotTables())
+	if len(changes) != 1 || len(changes[0].Inserted) != 0 || len(changes[0].Deleted) != 0 || len(changes[0].Updated) != 1 || changes[0].Updated[0].After["userid"] != int64(1) {
+		t.Fatalf("Rows should be matched on the key: %v", changes)
+	}
+	if statements := database.Statements(); statements[0].query != "SELECT * FROM memberships WHERE groupid=$1" {
+		t.Errorf("Snapshots should be filtered: %v", statements)
+	}
+	if markdown := markdownDatabaseChanges(changes); !strings.Contains(markdown, `| a\|b → admin |`) {
+		t.Errorf("Pipes should be escaped: %s", markdown)
+	}
+}
+
+func TestSqlRecorder(t *testing.T) {
+	_, database := openFakeDb(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), []byte("Alice")}}
+	})
+	recorder := NewSqlRecorder()
+	db := sql.OpenDB(recorder.Connector(database))
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func(w http.ResponseWriter, req *http.Request) {
+		rows, err := db.QueryContext(req.Context(), "SELECT id, name FROM users WHERE active=$1", true)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		users, _ := ScanToMap(rows, 0)
+		rows.Close()
+		for _, user := range users {
+			db.ExecContext(req.Context(), "UPDATE users SET seen=now() WHERE id=$1", user["id"])
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"Status": "OK"}`))
+	})
+	handler := MarkdownDebugMiddleware()(mux)
+
+	// Snapshots documenting database changes are not counted
+	DocumentDatabaseChanges(db, "users")
+	defer DocumentDatabaseChanges(nil)
+
+	recorder.Reset()
+	w := PerformRequest(handler, HttpRequest{Method: "GET", Path: "/users", Description: "Test GET Endpoint running queries"})
+	AssertResponseStatus(t, w, "OK")
+
+	queries := AssertQueryCount(t, recorder, 2)
+	if len(queries) == 2 && (queries[0].Args[0] != true || queries[1].Query != "UPDATE users SET seen=now() WHERE id=$1") {
+		t.Errorf("Unexpected queries: %v", queries)
+	}
+
+	exchanges := Exchanges()
+	if exchange := exchanges[len(exchanges)-1]; len(exchange.Queries) != 2 {
+		t.Errorf("Queries should be documented with the exchange: %v", exchange.Queries)
+	}
+
+	recorder.Reset()
+	db.Exec("DELETE FROM users")
+	AssertQueryCount(t, recorder, 1)
+}
+
+func TestDialects(t *testing.T) {
+	query, inArgs, _, err := NewSqlBuilder(Sqlite).Select("mytable").Returning("firstname").WhereArg("customerid", 5).WhereArg("active", true).Limit(3).Build()
+	if err != nil || query != "SELECT firstname FROM mytable WHERE customerid=? AND active=? LIMIT 3" || len(inArgs) != 2 {
+		t.Errorf("Mismatching sqlite query: %s %v", query, err)
+	}
+
+	query, _, _, err = NewSqlBuilder(MySql).QuotedIdentifiers().Update("order").SetArg("status", "paid").WhereArg("id", 5).Build()
+	if err != nil || query != "UPDATE `order` SET `status`=? WHERE `id`=?" {
+		t.Errorf("Mismatching mysql query: %s %v", query, err)
+	}
+
+	query, _, _, err = NewSqlBuilder(MySql).Select("users").Returning("id").WhereExpr(Cond("name", "not ilike", "a%")).Build()
+	if err != nil || query != "SELECT id FROM users WHERE LOWER(name) NOT LIKE LOWER(?)" {
+		t.Errorf("MySQL has no ILIKE: %s %v", query, err)
+	}
+
+	if _, _, _, err = NewSqlBuilder(MySql).Delete("mytable").WhereArg("id", 5).Returning("id").Build(); err == nil {
+		t.Errorf("MySQL has no RETURNING")
+	}
+
+	sb := PostgresSqlBuilder{}
+	query, _, _, err = sb.QuotedIdentifiers().Select("user").Returning("user.id", "count(id)").WhereArg("name", "x").Build()
+	if err != nil || query != `SELECT "user"."id", count("id") FROM "user" WHERE "name"=$1` {
+		t.Errorf("Mismatching postgres query: %s %v", query, err)
+	}
+
+	upsert := Upsert{ConflictColumns: []string{"email"}, Assignments: []string{"name=" + Postgres.ExcludedColumn("name")}}
+	if clause := Postgres.UpsertClause(upsert); clause != " ON CONFLICT (email) DO UPDATE SET name=EXCLUDED.name" {
+		t.Errorf("Mismatching postgres upsert: %s", clause)
+	}
+	if clause := MySql.UpsertClause(Upsert{ConflictColumns: []string{"email"}}); clause != " ON DUPLICATE KEY UPDATE email=email" {
+		t.Errorf("Mismatching mysql upsert: %s", clause)
+	}
+	if clause := Sqlite.LimitOffset(0, 10); clause != " LIMIT -1 OFFSET 10" {
+		t.Errorf("Mismatching sqlite offset: %s", clause)
+	}
+}
+
+// fakeDatabase is a scripted database/sql driver, statements are recorded and queries answered by a responder
+type fakeDatabase struct {
+	lock       sync.Mutex
+	statements []fakeStatement
+	respond    fakeResponder
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeResponder func(query string, args []driver.Value) ([]string, [][]driver.Value)
+
+type fakeConn struct {
+	database *fakeDatabase
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func openFakeDb(t *testing.T, respond fakeResponder) (*sql.DB, *fakeDatabase) {
+	database := &fakeDatabase{respond: respond, statements: make([]fakeStatement, 0)}
+	db := sql.OpenDB(database)
+	t.Cleanup(func() { db.Close() })
+	return db, database
+}
+
+func (d *fakeDatabase) Statements() []fakeStatement {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]fakeStatement{}, d.statements...)
+}
+
+func (d *fakeDatabase) record(query string, args []driver.Value) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.statements = append(d.statements, fakeStatement{query: query, args: args})
+}
+
+func (d *fakeDatabase) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{database: d}, nil
+}
+
+func (d *fakeDatabase) Driver() driver.Driver {
+	return nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.database.record("BEGIN", nil)
+	return &fakeTx{conn: c}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.database.record("COMMIT", nil)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.database.record("ROLLBACK", nil)
+	return nil
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.database.record(s.query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.database.record(s.query, args)
+	rows := &fakeRows{}
+	if s.conn.database.respond != nil {
+		rows.columns, rows.rows = s.conn.database.respond(s.query, args)
+	}
+	return rows, nil
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
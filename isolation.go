@@ -0,0 +1,42 @@
+package httptesting
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+var savepointCounter int64
+
+// BeginTestTransaction isolates a test: a transaction is started on a *sql.DB, or a savepoint inside a *sql.Tx,
+// and rolled back when the test finishes. Handlers under test should be given the returned executor
+func BeginTestTransaction(t testing.TB, db SqlExecutor) SqlExecutor {
+	t.Helper()
+	switch d := db.(type) {
+	case *sql.DB:
+		tx, err := d.Begin()
+		if err != nil {
+			t.Fatalf("Cannot begin transaction: %s\n", err.Error())
+		}
+		t.Cleanup(func() {
+			if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+				t.Errorf("Cannot roll back transaction: %s\n", err.Error())
+			}
+		})
+		return tx
+	case *sql.Tx:
+		savepoint := fmt.Sprintf("httptesting_%d", atomic.AddInt64(&savepointCounter, 1))
+		if _, err := d.Exec("SAVEPOINT " + savepoint); err != nil {
+			t.Fatalf("Cannot create savepoint: %s\n", err.Error())
+		}
+		t.Cleanup(func() {
+			if _, err := d.Exec("ROLLBACK TO SAVEPOINT " + savepoint); err != nil {
+				t.Errorf("Cannot roll back to savepoint: %s\n", err.Error())
+			}
+		})
+		return d
+	}
+	t.Fatalf("Cannot isolate %T, a *sql.DB or *sql.Tx is expected\n", db)
+	return nil
+}
@@ -0,0 +1,109 @@
+package httptesting
+
+import (
+	"errors"
+	"strings"
+)
+
+type joinClause struct {
+	kind  string
+	table string
+	alias string
+	raw   string
+	on    []Condition
+}
+
+type columnComparison struct {
+	left         string
+	relationship string
+	right        string
+}
+
+// ColumnsEqual compares two columns, e.g. a join condition ColumnsEqual("o.user_id", "u.id")
+func ColumnsEqual(left string, right string) Condition {
+	return CompareColumns(left, "=", right)
+}
+
+// CompareColumns compares two columns with a relationship, nothing is bound
+func CompareColumns(left string, relationship string, right string) Condition {
+	return &columnComparison{left: left, relationship: strings.TrimSpace(relationship), right: right}
+}
+
+func (c *columnComparison) render(s *SqlBuilder) string {
+	return s.compare(s.identifier(c.left), c.relationship, s.identifier(c.right))
+}
+
+// As sets the alias of the selected table, e.g. Select("users").As("u")
+func (s *SqlBuilder) As(alias string) *SqlBuilder {
+	s.tableAlias = alias
+	return s
+}
+
+// InnerJoin joins a table under an alias, conditions are given here or with On
+func (s *SqlBuilder) InnerJoin(table string, alias string, on ...Condition) *SqlBuilder {
+	return s.addJoin("INNER JOIN", table, alias, on)
+}
+
+// LeftJoin joins a table under an alias, keeping rows without a match
+func (s *SqlBuilder) LeftJoin(table string, alias string, on ...Condition) *SqlBuilder {
+	return s.addJoin("LEFT JOIN", table, alias, on)
+}
+
+// RightJoin joins a table under an alias, keeping rows of the joined table without a match
+func (s *SqlBuilder) RightJoin(table string, alias string, on ...Condition) *SqlBuilder {
+	return s.addJoin("RIGHT JOIN", table, alias, on)
+}
+
+// FullJoin joins a table under an alias, keeping rows of both tables without a match
+func (s *SqlBuilder) FullJoin(table string, alias string, on ...Condition) *SqlBuilder {
+	if s.Dialect() == MySql {
+		s.err = errors.New("FULL JOIN is not supported by " + s.Dialect().Name())
+	}
+	return s.addJoin("FULL JOIN", table, alias, on)
+}
+
+// On adds conditions to the last join, they may bind arguments: On(ColumnsEqual("o.user_id", "u.id"), Equal("o.status", "paid"))
+func (s *SqlBuilder) On(conditions ...Condition) *SqlBuilder {
+	if len(s.joins) == 0 || len(s.joins[len(s.joins)-1].raw) > 0 {
+		s.err = errors.New("On has to follow a join")
+		return s
+	}
+	join := s.joins[len(s.joins)-1]
+	join.on = append(join.on, conditions...)
+	return s
+}
+
+func (s *SqlBuilder) addJoin(kind string, table string, alias string, on []Condition) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of joins is not appropriate")
+		return s
+	}
+	table = strings.TrimSpace(table)
+	if len(table) == 0 {
+		s.err = errors.New("Joined table name has to be specified")
+	}
+	s.joins = append(s.joins, &joinClause{kind: kind, table: table, alias: strings.TrimSpace(alias), on: on})
+	return s
+}
+
+func buildJoin(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	for _, join := range s.joins {
+		if len(join.raw) > 0 {
+			sb.Write(join.raw).Write(" ")
+			continue
+		}
+
+		sb.Write(join.kind, " ", s.identifier(join.table))
+		if len(join.alias) > 0 {
+			sb.Write(" ", s.identifier(join.alias))
+		}
+		if len(join.on) == 0 {
+			s.err = errors.New("Join of " + join.table + " has no conditions")
+		}
+		sb.Write(" ON ", renderConditions(s, join.on), " ")
+	}
+
+	return sb.String()
+}
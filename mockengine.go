@@ -0,0 +1,235 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MockOptions control how recorded exchanges are matched against incoming requests
+type MockOptions struct {
+	// MatchBody requires the request body to be equal to the recorded one, json documents are compared structurally
+	MatchBody bool
+}
+
+// RecordedResponse is an entry of a responses file, complementing a request of a .http file
+type RecordedResponse struct {
+	Name    string            `json:"name,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type mockHandler struct {
+	recording *Recording
+	options   MockOptions
+}
+
+// NewMockEngine builds a gin engine replaying recorded exchanges, e.g. from the chitchat.json sidecar
+func NewMockEngine(rec *Recording) *gin.Engine {
+	return NewMockEngineWithOptions(rec, MockOptions{})
+}
+
+func NewMockEngineWithOptions(rec *Recording, options MockOptions) *gin.Engine {
+	r := gin.New()
+	r.NoRoute(gin.WrapH(NewMockHandler(rec, options)))
+	return r
+}
+
+// NewMockHandler builds a plain http.Handler replaying recorded exchanges.
+// Requests are matched on method, route template and optionally body, unmatched requests get a 501
+func NewMockHandler(rec *Recording, options MockOptions) http.Handler {
+	return &mockHandler{recording: rec, options: options}
+}
+
+// LoadHttpRecording combines requests of a .http file with a json list of responses, matched by name or position
+func LoadHttpRecording(httpFileName string, responsesFileName string) (*Recording, error) {
+	httpFile, err := LoadHttpFile(httpFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(responsesFileName)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]RecordedResponse, 0)
+	err = json.Unmarshal(content, &responses)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", responsesFileName, err)
+	}
+
+	rec := httpFile.Recording()
+	for i := range rec.Exchanges {
+		exchange := &rec.Exchanges[i]
+		response := findRecordedResponse(responses, exchange.Name, i)
+		if response == nil {
+			return nil, fmt.Errorf("no response recorded for %s %s", exchange.Method, exchange.Url)
+		}
+
+		exchange.Status = response.Status
+		exchange.ResponseHeaders = make(http.Header)
+		for k, v := range response.Headers {
+			exchange.ResponseHeaders.Set(k, v)
+		}
+
+		var text string
+		if err := json.Unmarshal(response.Body, &text); err == nil {
+			exchange.ResponseBody = text
+		} else {
+			exchange.ResponseBody = string(response.Body)
+			if len(exchange.ResponseHeaders.Get("Content-Type")) == 0 {
+				exchange.ResponseHeaders.Set("Content-Type", "application/json; charset=utf-8")
+			}
+		}
+	}
+	return rec, nil
+}
+
+func findRecordedResponse(responses []RecordedResponse, name string, index int) *RecordedResponse {
+	if len(name) > 0 {
+		for i := range responses {
+			if responses[i].Name == name {
+				return &responses[i]
+			}
+		}
+	}
+	if index < len(responses) && len(responses[index].Name) == 0 {
+		return &responses[index]
+	}
+	return nil
+}
+
+func (h *mockHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+	}
+
+	exchange := h.match(req, body)
+	if exchange == nil {
+		h.notImplemented(w, req)
+		return
+	}
+
+	for k, values := range exchange.ResponseHeaders {
+		if k == "Content-Length" {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	status := exchange.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(exchange.ResponseBody))
+}
+
+func (h *mockHandler) match(req *http.Request, body []byte) *Exchange {
+	var best *Exchange
+	for i := range h.recording.Exchanges {
+		exchange := &h.recording.Exchanges[i]
+		if exchange.Method != req.Method {
+			continue
+		}
+		if _, ok := matchRoute(exchangeRoute(*exchange), req.URL.Path); !ok {
+			continue
+		}
+		if h.options.MatchBody && !equalBodies(exchange.RequestBody, string(body)) {
+			continue
+		}
+		// An exchange recorded with the very same url wins over a route template match
+		if urlPath(exchange.Url) == req.URL.RequestURI() {
+			return exchange
+		}
+		if best == nil {
+			best = exchange
+		}
+	}
+	return best
+}
+
+func (h *mockHandler) notImplemented(w http.ResponseWriter, req *http.Request) {
+	requested := req.Method + " " + req.URL.Path
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	candidates := make([]candidate, 0)
+	seen := make(map[string]bool)
+	for _, exchange := range h.recording.Exchanges {
+		name := exchange.Method + " " + exchangeRoute(exchange)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		candidates = append(candidates, candidate{name: name, distance: levenshtein(requested, name)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+
+	nearest := make([]string, 0)
+	for i := 0; i < len(candidates) && i < 3; i++ {
+		nearest = append(nearest, candidates[i].name)
+	}
+
+	jsonDoc, _ := json.MarshalIndent(map[string]interface{}{
+		"Status":     "Error",
+		"Error":      "No recorded exchange matches " + requested,
+		"Candidates": nearest,
+	}, "", "\t")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusNotImplemented)
+	w.Write(jsonDoc)
+}
+
+func exchangeRoute(exchange Exchange) string {
+	route := exchange.Route
+	if len(route) == 0 {
+		route = urlPath(exchange.Url)
+	}
+	return strings.SplitN(route, "?", 2)[0]
+}
+
+func equalBodies(expected string, actual string) bool {
+	var expectedJson, actualJson interface{}
+	if json.Unmarshal([]byte(expected), &expectedJson) == nil && json.Unmarshal([]byte(actual), &actualJson) == nil {
+		return len(diffJson("", expectedJson, actualJson)) == 0
+	}
+	return strings.TrimSpace(expected) == strings.TrimSpace(actual)
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,117 @@
+package httptesting
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkMode selects how PerformRequest reaches the handler under test
+type NetworkMode int
+
+const (
+	// InProcess calls ServeHTTP directly, the default
+	InProcess NetworkMode = iota
+	// HttpServer goes through a real socket, using httptest.NewServer and the net/http client
+	HttpServer
+	// TlsServer is HttpServer over TLS, using httptest.NewTLSServer
+	TlsServer
+)
+
+type testServer struct {
+	handler http.Handler
+	mode    NetworkMode
+	server  *httptest.Server
+}
+
+var networkMode = InProcess
+var testServers = make([]testServer, 0)
+var testServersLock sync.Mutex
+
+// UseNetworkMode makes PerformRequest go through a real server, e.g. to catch Content-Length, chunking or
+// Connection handling issues. Servers are started lazily, one per handler, and closed on Teardown().
+// Handlers which are not comparable, like http.HandlerFunc, get a new server for every request
+func UseNetworkMode(mode NetworkMode) {
+	networkMode = mode
+}
+
+// TestServer returns the server wrapping a handler in the current network mode, starting it if needed
+func TestServer(r http.Handler) *httptest.Server {
+	mode := networkMode
+	if mode == InProcess {
+		mode = HttpServer
+	}
+
+	testServersLock.Lock()
+	defer testServersLock.Unlock()
+
+	if reflect.TypeOf(r).Comparable() {
+		for _, s := range testServers {
+			if s.mode == mode && reflect.TypeOf(s.handler) == reflect.TypeOf(r) && s.handler == r {
+				return s.server
+			}
+		}
+	}
+
+	var server *httptest.Server
+	if mode == TlsServer {
+		server = httptest.NewTLSServer(r)
+	} else {
+		server = httptest.NewServer(r)
+	}
+	testServers = append(testServers, testServer{handler: r, mode: mode, server: server})
+	return server
+}
+
+func closeTestServers() {
+	testServersLock.Lock()
+	defer testServersLock.Unlock()
+
+	for _, s := range testServers {
+		s.server.Close()
+	}
+	testServers = make([]testServer, 0)
+}
+
+func performNetworkRequest(r http.Handler, req *http.Request, pending *pendingRequest) *httptest.ResponseRecorder {
+	server := TestServer(r)
+
+	url := server.URL + req.URL.RequestURI()
+	networkReq, err := http.NewRequest(req.Method, url, nil)
+	w := httptest.NewRecorder()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteString(err.Error())
+		return w
+	}
+	networkReq.Header = req.Header
+	networkReq.Body = req.Body
+	networkReq.GetBody = req.GetBody
+	networkReq.ContentLength = req.ContentLength
+
+	res, err := server.Client().Do(networkReq)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		w.WriteString(err.Error())
+		return w
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	// The response may reach the client before the logger is done documenting the exchange
+	pending.wait(10 * time.Second)
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	if len(res.TransferEncoding) > 0 {
+		w.Header().Set("Transfer-Encoding", strings.Join(res.TransferEncoding, ", "))
+	}
+	w.WriteHeader(res.StatusCode)
+	w.Write(body)
+	return w
+}
@@ -0,0 +1,170 @@
+package httptesting
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type keysetCondition struct {
+	values []interface{}
+}
+
+func (s *SqlBuilder) Offset(offset int) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of Offset is not appropriate")
+	}
+	if offset < 0 {
+		s.err = errors.New("Offset can not be negative")
+	}
+	s.offset = offset
+	return s
+}
+
+// SeekAfter continues keyset pagination after a row, values are the ones of the OrderBy columns of the last row seen,
+// see CursorFor and DecodeCursor. OrderBy has to be applied first, the order should end with a unique column.
+// Unfiltered lists combine it with All()
+func (s *SqlBuilder) SeekAfter(values ...interface{}) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of SeekAfter is not appropriate")
+		return s
+	}
+	return s.WhereExpr(&keysetCondition{values: values})
+}
+
+// WithTotalCount adds the number of rows matching the query regardless of LIMIT and OFFSET to every row,
+// using a window function: count(*) OVER () AS alias
+func (s *SqlBuilder) WithTotalCount(alias string) *SqlBuilder {
+	if !s.selectFlag {
+		s.err = errors.New("In this mode usage of WithTotalCount is not appropriate")
+		return s
+	}
+	alias = strings.TrimSpace(alias)
+	if !identifierPattern.MatchString(alias) || strings.Contains(alias, ".") {
+		s.err = errors.New("Total count alias " + alias + " is not a valid identifier")
+		return s
+	}
+	s.totalCountAlias = alias
+	return s
+}
+
+// Columns ordered the same way are compared as a tuple, (a, b) > ($1, $2),
+// mixed directions are expanded: a > $1 OR (a = $1 AND b < $2)
+func (c *keysetCondition) render(s *SqlBuilder) string {
+	columns, directions := s.orderColumns()
+	if len(columns) == 0 || len(columns) != len(c.values) {
+		s.err = errors.New("SeekAfter needs a value for every OrderBy column")
+		return ""
+	}
+
+	operators := make([]string, len(columns))
+	uniform := true
+	for i, direction := range directions {
+		switch direction {
+		case "ASC":
+			operators[i] = ">"
+		case "DESC":
+			operators[i] = "<"
+		default:
+			s.err = errors.New("SeekAfter only supports ASC and DESC orders")
+			return ""
+		}
+		uniform = uniform && operators[i] == operators[0]
+	}
+
+	if uniform {
+		identifiers := make([]string, 0, len(columns))
+		placeholders := make([]string, 0, len(columns))
+		for i, column := range columns {
+			identifiers = append(identifiers, s.identifier(column))
+			placeholders = append(placeholders, s.bind(column, c.values[i]))
+		}
+		if len(columns) == 1 {
+			return identifiers[0] + operators[0] + placeholders[0]
+		}
+		return "(" + strings.Join(identifiers, ", ") + ")" + operators[0] + "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	alternatives := make([]string, 0, len(columns))
+	for i := range columns {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, s.identifier(columns[j])+"="+s.bind(columns[j], c.values[j]))
+		}
+		terms = append(terms, s.identifier(columns[i])+operators[i]+s.bind(columns[i], c.values[i]))
+		if len(terms) == 1 {
+			alternatives = append(alternatives, terms[0])
+		} else {
+			alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+		}
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func (s *SqlBuilder) orderColumns() ([]string, []string) {
+	columns := make([]string, 0)
+	directions := make([]string, 0)
+	if s.orderByParams == nil {
+		return columns, directions
+	}
+	for _, name := range s.orderByParams.Keys() {
+		direction, _ := s.orderByParams.Get(name)
+		columns = append(columns, name.(string))
+		directions = append(directions, strings.ToUpper(strings.TrimSpace(direction.(string))))
+	}
+	return columns, directions
+}
+
+// EncodeCursor turns the order values of the last row into an opaque token for API responses
+func EncodeCursor(values ...interface{}) (string, error) {
+	jsonDoc, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(jsonDoc), nil
+}
+
+// DecodeCursor reads the values of a token created by EncodeCursor, whole numbers come back as int64
+func DecodeCursor(token string) ([]interface{}, error) {
+	jsonDoc, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("Malformed cursor")
+	}
+
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonDoc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errors.New("Malformed cursor")
+	}
+	for i, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if n, err := number.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := number.Float64(); err == nil {
+				values[i] = f
+			}
+		}
+	}
+	return values, nil
+}
+
+// CursorFor encodes the OrderBy column values of a row returned by ScanToMap, aliases like u.id are looked up as id
+func (s *SqlBuilder) CursorFor(row map[string]interface{}) (string, error) {
+	columns, _ := s.orderColumns()
+	values := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		name := column
+		if index := strings.LastIndex(name, "."); index >= 0 {
+			name = name[index+1:]
+		}
+		value, ok := row[name]
+		if !ok {
+			return "", errors.New("Row has no " + name + " column")
+		}
+		values = append(values, columnValue(value))
+	}
+	return EncodeCursor(values...)
+}
@@ -0,0 +1,362 @@
+package httptesting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pendingRequest is a request performed by PerformRequest, so the logger can document what was lost
+// when the body was marshalled, and PerformRequest can wait for the documentation to be written
+type pendingRequest struct {
+	request HttpRequest
+	taken   bool
+	done    chan struct{}
+}
+
+var pendingRequests = make(map[string]*pendingRequest)
+var pendingRequestsLock sync.Mutex
+
+func registerPendingRequest(id string, request HttpRequest) *pendingRequest {
+	pendingRequestsLock.Lock()
+	defer pendingRequestsLock.Unlock()
+	pending := &pendingRequest{request: request, done: make(chan struct{})}
+	pendingRequests[id] = pending
+	return pending
+}
+
+func takePendingRequest(id string) *pendingRequest {
+	pendingRequestsLock.Lock()
+	defer pendingRequestsLock.Unlock()
+	pending, ok := pendingRequests[id]
+	if !ok {
+		return nil
+	}
+	delete(pendingRequests, id)
+	pending.taken = true
+	return pending
+}
+
+func (p *pendingRequest) wait(timeout time.Duration) {
+	pendingRequestsLock.Lock()
+	taken := p.taken
+	pendingRequestsLock.Unlock()
+
+	if taken {
+		select {
+		case <-p.done:
+		case <-time.After(timeout):
+		}
+	}
+}
+
+type exchangeCapture struct {
+	exchange        Exchange
+	headerTemplates http.Header
+	hasBody         bool
+	pending         *pendingRequest
+	snapshot        map[string][]map[string]interface{}
+	// Guards exchange.DownstreamCalls, handlers may call other services concurrently
+	lock sync.Mutex
+}
+
+// captureRequest returns nil for requests which should not be documented
+func captureRequest(req *http.Request) *exchangeCapture {
+	description := req.Header.Get("__httptesting_desc")
+	name := req.Header.Get("__httptesting_name")
+
+	pending := takePendingRequest(req.Header.Get("__httptesting_id"))
+	if !documenting(description) {
+		if pending != nil {
+			close(pending.done)
+		}
+		return nil
+	}
+
+	capture := newExchangeCapture(req, name, description)
+	capture.pending = pending
+	capture.snapshot = snapshotTables()
+	if pending != nil {
+		capture.exchange.RequestSchema = DescribeBody(pending.request.Body)
+	}
+	return capture
+}
+
+func documenting(description string) bool {
+	return len(description) > 0 && (docFile != nil || httpFile != nil || recordingFile != nil)
+}
+
+func newExchangeCapture(req *http.Request, name string, description string) *exchangeCapture {
+	capture := &exchangeCapture{
+		exchange:        Exchange{Name: name, Description: description, Method: req.Method, Url: req.URL.String(), RequestHeaders: http.Header{}},
+		headerTemplates: http.Header{},
+	}
+
+	for k, v := range req.Header {
+		if strings.Index(k, "__httptesting") == 0 {
+			continue
+		}
+		for i, v1 := range v {
+			capture.headerTemplates.Add(k, v1)
+			v[i] = PopulateVariables(v1)
+			capture.exchange.RequestHeaders.Add(k, v[i])
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		buf, _ := ioutil.ReadAll(req.Body)
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
+		capture.exchange.RequestBody = string(buf)
+		capture.hasBody = true
+	}
+	return capture
+}
+
+func (e *exchangeCapture) complete(route string, params []PathParam, status int, header http.Header, body string) {
+	if len(route) > 0 {
+		e.exchange.Route = route
+	} else {
+		e.exchange.Route = strings.SplitN(urlPath(e.exchange.Url), "?", 2)[0]
+	}
+	if len(params) > 0 {
+		e.exchange.PathParams = make(map[string]string)
+		for _, p := range params {
+			e.exchange.PathParams[p.Key] = p.Value
+		}
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.exchange.Status = status
+	e.exchange.ResponseHeaders = header.Clone()
+	e.exchange.ResponseBody = body
+	if e.snapshot != nil {
+		e.exchange.DatabaseChanges = diffSnapshots(e.snapshot, snapshotTables())
+	}
+
+	recordExchange(e.exchange)
+	e.writeHttpFile()
+	e.writeMarkdown(params)
+	if e.pending != nil {
+		close(e.pending.done)
+	}
+}
+
+func (e *exchangeCapture) fail(err error) {
+	e.exchange.Route = strings.SplitN(urlPath(e.exchange.Url), "?", 2)[0]
+	e.exchange.Error = err.Error()
+
+	recordExchange(e.exchange)
+	e.writeHttpFile()
+	e.writeMarkdown(nil)
+}
+
+func (e *exchangeCapture) writeHttpFile() {
+	if httpFile == nil {
+		return
+	}
+
+	httpFile.WriteString("###\n")
+	httpFile.WriteString(fmt.Sprintf("# %s\n", e.exchange.Description))
+	if len(e.exchange.Name) > 0 {
+		httpFile.WriteString(fmt.Sprintf("# @name %s\n", e.exchange.Name))
+	}
+	if isAbsoluteUrl(e.exchange.Url) {
+		// Remote requests keep their fully qualified url
+		httpFile.WriteString(fmt.Sprintf("%s %s\n", e.exchange.Method, e.exchange.Url))
+	} else {
+		httpFile.WriteString(fmt.Sprintf("%s {{baseUrl}}%s\n", e.exchange.Method, e.exchange.Url))
+	}
+
+	for _, k := range sortedHeaderNames(e.headerTemplates) {
+		for _, v := range e.headerTemplates[k] {
+			httpFile.WriteString(fmt.Sprintf("%s: %s\n", k, v))
+		}
+	}
+	httpFile.WriteString("\n")
+
+	if e.hasBody {
+		httpFile.WriteString(fmt.Sprintf("%s\n", e.exchange.RequestBody))
+	}
+	httpFile.WriteString("\n")
+}
+
+func (e *exchangeCapture) writeMarkdown(params []PathParam) {
+	if docFile == nil {
+		return
+	}
+
+	// Route template, actual values are documented in the path parameter table
+	route := e.exchange.Route
+	if isAbsoluteUrl(e.exchange.Url) {
+		route = urlOrigin(e.exchange.Url) + route
+	}
+	if index := strings.Index(e.exchange.Url, "?"); index >= 0 {
+		route = route + e.exchange.Url[index:]
+	}
+
+	docFile.WriteString(fmt.Sprintf("\n* %s `%s` %s\n\n", e.exchange.Method, route, e.exchange.Description))
+	if len(params) > 0 {
+		docFile.WriteString("   - Path parameters:\n\n")
+		docFile.WriteString("      | Name | Value |\n")
+		docFile.WriteString("      | ---- | ----- |\n")
+		for _, p := range params {
+			docFile.WriteString(fmt.Sprintf("      | `%s` | `%s` |\n", p.Key, p.Value))
+		}
+		docFile.WriteString("\n")
+	}
+
+	docFile.WriteString("   - Request:\n")
+	docFile.WriteString("      - Headers:\n")
+	for _, k := range sortedHeaderNames(e.headerTemplates) {
+		for _, v := range e.headerTemplates[k] {
+			docFile.WriteString(fmt.Sprintf("         - `%s`: `%s`\n", k, v))
+		}
+	}
+
+	if e.hasBody {
+		docFile.WriteString(fmt.Sprintf("      - Body:\n\t\t```json\n%s\t\t```\n", indent(e.exchange.RequestBody)))
+		if len(e.exchange.RequestSchema) > 0 {
+			docFile.WriteString("      - Fields:\n\n")
+			docFile.WriteString("         | Field | Type | Required | Description |\n")
+			docFile.WriteString("         | ----- | ---- | -------- | ----------- |\n")
+			for _, field := range e.exchange.RequestSchema {
+				required := "no"
+				if field.Required {
+					required = "yes"
+				}
+				docFile.WriteString(fmt.Sprintf("         | `%s` | `%s` | %s | %s |\n", field.Name, field.Type, required, field.Description))
+			}
+			docFile.WriteString("\n")
+		}
+	}
+
+	if len(e.exchange.Error) > 0 {
+		docFile.WriteString(fmt.Sprintf("\n   - Failed: %s\n", e.exchange.Error))
+		return
+	}
+
+	docFile.WriteString(fmt.Sprintf("\n   - Response (%d)\n", e.exchange.Status))
+
+	if len(e.exchange.ResponseHeaders) > 0 {
+		docFile.WriteString("      - Headers:\n")
+		for _, k := range sortedHeaderNames(e.exchange.ResponseHeaders) {
+			for _, v := range e.exchange.ResponseHeaders[k] {
+				docFile.WriteString(fmt.Sprintf("         - `%s`: `%s`\n", k, v))
+			}
+		}
+	}
+
+	var response map[string]interface{}
+	err := json.Unmarshal([]byte(e.exchange.ResponseBody), &response)
+	if err != nil {
+		docFile.WriteString(fmt.Sprintf("\n      - Body:\n\t\t```text\n%s\t\t```\n", indent(e.exchange.ResponseBody)))
+	} else {
+		jsonDoc, _ := json.MarshalIndent(response, "", "\t")
+		docFile.WriteString(fmt.Sprintf("\n      - Body:\n\t\t```json\n%s\t\t```\n", indent(string(jsonDoc))))
+	}
+
+	if len(e.exchange.Queries) > 0 {
+		docFile.WriteString(fmt.Sprintf("\n   - SQL (%d queries):\n", len(e.exchange.Queries)))
+		for _, query := range e.exchange.Queries {
+			docFile.WriteString(fmt.Sprintf("      - `%s`", query.Query))
+			if len(query.Args) > 0 {
+				docFile.WriteString(fmt.Sprintf(" %v", query.Args))
+			}
+			if len(query.Error) > 0 {
+				docFile.WriteString(fmt.Sprintf(" failed: %s", query.Error))
+			}
+			docFile.WriteString("\n")
+		}
+	}
+
+	if len(e.exchange.DatabaseChanges) > 0 {
+		docFile.WriteString(markdownDatabaseChanges(e.exchange.DatabaseChanges))
+	}
+
+	if len(e.exchange.DownstreamCalls) > 0 {
+		docFile.WriteString("\n   - Downstream calls:\n")
+		for _, call := range e.exchange.DownstreamCalls {
+			if len(call.Error) > 0 {
+				docFile.WriteString(fmt.Sprintf("      - %s `%s` failed: %s\n", call.Method, call.Url, call.Error))
+				continue
+			}
+			docFile.WriteString(fmt.Sprintf("      - %s `%s` (%d)\n", call.Method, call.Url, call.Status))
+			if len(call.RequestBody) > 0 {
+				docFile.WriteString(fmt.Sprintf("         - Request:\n\t\t```\n%s\t\t```\n", indent(call.RequestBody)))
+			}
+			if len(call.ResponseBody) > 0 {
+				docFile.WriteString(fmt.Sprintf("         - Response:\n\t\t```\n%s\t\t```\n", indent(call.ResponseBody)))
+			}
+		}
+	}
+}
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// MarkdownDebugMiddleware is MarkdownDebugLogger for any http.Handler, e.g. `MarkdownDebugMiddleware(ChiRoutes("/users/{id}"))(mux)`.
+// Route templates come from the given resolvers, or from the wrapped handler if it implements RouteResolver
+func MarkdownDebugMiddleware(resolvers ...RouteResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handlerResolvers := append([]RouteResolver{}, resolvers...)
+		if resolver, ok := next.(RouteResolver); ok {
+			handlerResolvers = append(handlerResolvers, resolver)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			capture := captureRequest(req)
+			if capture == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+			req = req.WithContext(withExchangeCapture(req.Context(), capture))
+
+			wr := &recordingResponseWriter{ResponseWriter: w, body: bytes.NewBufferString("")}
+			next.ServeHTTP(wr, req)
+
+			status := wr.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// Routers like chi only know the matched route after the request was handled
+			route, params := "", []PathParam(nil)
+			for _, resolver := range handlerResolvers {
+				if r, p, ok := resolver.ResolveRoute(req); ok {
+					route, params = r, p
+					break
+				}
+			}
+			capture.complete(route, params, status, wr.Header(), wr.body.String())
+		})
+	}
+}
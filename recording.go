@@ -0,0 +1,102 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Exchange is a single request/response pair captured by MarkdownDebugLogger
+// or by the httptesting command
+type Exchange struct {
+	Name            string            `json:"name,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Method          string            `json:"method"`
+	Url             string            `json:"url"`
+	Route           string            `json:"route,omitempty"`
+	PathParams      map[string]string `json:"pathParams,omitempty"`
+	RequestHeaders  http.Header       `json:"requestHeaders,omitempty"`
+	RequestBody     string            `json:"requestBody,omitempty"`
+	RequestSchema   []SchemaField     `json:"requestSchema,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders http.Header       `json:"responseHeaders,omitempty"`
+	ResponseBody    string            `json:"responseBody,omitempty"`
+	DownstreamCalls []DownstreamCall  `json:"downstreamCalls,omitempty"`
+	DatabaseChanges []DatabaseChange  `json:"databaseChanges,omitempty"`
+	Queries         []ExecutedQuery   `json:"queries,omitempty"`
+	// Error of a remote request which got no response
+	Error string `json:"error,omitempty"`
+}
+
+// Recording is the JSON sidecar of chitchat.md, a machine readable list of all exchanges
+type Recording struct {
+	BaseUrl   string     `json:"baseUrl,omitempty"`
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+var recordingFile *os.File
+var recording = Recording{Exchanges: make([]Exchange, 0)}
+
+// PrepareRecording enables the JSON sidecar, which is written out on Teardown()
+func PrepareRecording(recordingFileName string) {
+	if len(strings.TrimSpace(recordingFileName)) > 0 {
+		var err error
+		recordingFile, err = os.Create(recordingFileName)
+		if err != nil {
+			fmt.Printf("Error: cannot open %s: %v\n", recordingFileName, err)
+		}
+	}
+	recording.BaseUrl = baseUrl
+}
+
+// Exchanges returns all exchanges recorded since the start of the test run
+func Exchanges() []Exchange {
+	return recording.Exchanges
+}
+
+func recordExchange(exchange Exchange) {
+	recording.Exchanges = append(recording.Exchanges, exchange)
+}
+
+func writeRecording() error {
+	if recordingFile == nil {
+		return nil
+	}
+	if len(recording.BaseUrl) == 0 {
+		recording.BaseUrl = baseUrl
+	}
+
+	jsonDoc, err := json.MarshalIndent(recording, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = recordingFile.Write(jsonDoc)
+	return err
+}
+
+// LoadRecording reads a recording previously written by PrepareRecording()/Teardown()
+func LoadRecording(fileName string) (*Recording, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Recording{}
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse recording %s: %v", fileName, err)
+	}
+	return &result, nil
+}
+
+// SaveRecording writes a recording in the same format PrepareRecording() does
+func SaveRecording(fileName string, rec *Recording) error {
+	jsonDoc, err := json.MarshalIndent(rec, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, jsonDoc, 0644)
+}
@@ -0,0 +1,150 @@
+package httptesting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+)
+
+// RemoteResponse is what a remote server answered to PerformRemoteRequest
+type RemoteResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Duration of the last attempt
+	Duration time.Duration
+	Attempts int
+}
+
+func (r *RemoteResponse) Json(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// RemoteClient performs requests against fully qualified urls. The transport, timeout and cookie jar
+// are taken from Client, failed attempts are retried Retries times, waiting Backoff, doubled after every attempt.
+// Transport errors are only retried for idempotent methods, a POST may have reached the server already
+type RemoteClient struct {
+	Client        *http.Client
+	Retries       int
+	Backoff       time.Duration
+	RetryStatuses []int
+}
+
+// DefaultRemoteClient is used by PerformRemoteRequest
+var DefaultRemoteClient = NewRemoteClient()
+
+// NewRemoteClient returns a client with a 10 second timeout and a cookie jar, retrying 502, 503 and 504 responses once set up with Retries
+func NewRemoteClient() *RemoteClient {
+	jar, _ := cookiejar.New(nil)
+	return &RemoteClient{
+		Client:        &http.Client{Timeout: time.Second * 10, Jar: jar},
+		Backoff:       time.Millisecond * 200,
+		RetryStatuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// Makes a call to a fully qualified remote url with DefaultRemoteClient
+func PerformRemoteRequest(ctx context.Context, request HttpRequest) (*RemoteResponse, error) {
+	return DefaultRemoteClient.Perform(ctx, request)
+}
+
+// Perform makes a call to a fully qualified remote url. Requests with a description are documented
+// like the ones made by PerformRequest, only the last attempt is recorded, even if it failed.
+// Cancelling the context ends the retries early, the attempt waiting for its retry is recorded as failed
+func (c *RemoteClient) Perform(ctx context.Context, request HttpRequest) (*RemoteResponse, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := c.Backoff
+	for attempt := 1; ; attempt++ {
+		req, err := newRemoteRequest(request)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+
+		var capture *exchangeCapture
+		if documenting(request.Description) {
+			capture = newExchangeCapture(req, request.Name, request.Description)
+			capture.exchange.RequestSchema = DescribeBody(request.Body)
+		} else {
+			for _, v := range req.Header {
+				for i, v1 := range v {
+					v[i] = PopulateVariables(v1)
+				}
+			}
+		}
+
+		response, err := c.attempt(client, req)
+		if err == nil {
+			response.Attempts = attempt
+		}
+		if attempt > c.Retries || !c.retryable(req.Method, response, err) || ctx.Err() != nil {
+			if err != nil {
+				fmt.Printf("Error: %s\n", err.Error())
+				if capture != nil {
+					capture.fail(err)
+				}
+				return nil, err
+			}
+			if capture != nil {
+				capture.complete("", nil, response.StatusCode, response.Header, string(response.Body))
+			}
+			return response, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Error: %s\n", ctx.Err().Error())
+			if capture != nil {
+				capture.fail(ctx.Err())
+			}
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *RemoteClient) attempt(client *http.Client, req *http.Request) (*RemoteResponse, error) {
+	started := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteResponse{StatusCode: res.StatusCode, Header: res.Header, Body: body, Duration: time.Since(started)}, nil
+}
+
+func (c *RemoteClient) retryable(method string, response *RemoteResponse, err error) bool {
+	if err != nil {
+		return idempotent(method)
+	}
+	for _, status := range c.RetryStatuses {
+		if response.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
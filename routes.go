@@ -0,0 +1,167 @@
+package httptesting
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PathParam is a route parameter and its actual value
+type PathParam struct {
+	Key   string
+	Value string
+}
+
+// RouteResolver finds the route template a request was matched against, e.g. /users/:id for /users/5.
+// It is consulted after the request was handled
+type RouteResolver interface {
+	ResolveRoute(req *http.Request) (route string, params []PathParam, ok bool)
+}
+
+// RouteResolverFunc adapts a function to RouteResolver, e.g. one reading chi.RouteContext(req.Context()).RoutePattern()
+type RouteResolverFunc func(req *http.Request) (string, []PathParam, bool)
+
+func (f RouteResolverFunc) ResolveRoute(req *http.Request) (string, []PathParam, bool) {
+	return f(req)
+}
+
+type patternResolver struct {
+	patterns []string
+}
+
+type ginResolver struct {
+	engine *gin.Engine
+}
+
+type serveMuxResolver struct {
+	mux *http.ServeMux
+}
+
+// GinRoutes resolves routes registered with a gin engine, for when the engine is wrapped by plain http.Handler middleware
+func GinRoutes(engine *gin.Engine) RouteResolver {
+	return &ginResolver{engine: engine}
+}
+
+// ChiRoutes resolves chi style patterns: /users/{id}, /users/{id:[0-9]+} and /files/*, optionally prefixed by a method, e.g. "GET /users/{id}"
+func ChiRoutes(patterns ...string) RouteResolver {
+	return &patternResolver{patterns: patterns}
+}
+
+// ServeMuxRoutes resolves the pattern a http.ServeMux picked for a request, e.g. /users/ for /users/7.
+// Patterns are the legacy ones without wildcards, so no path parameters are documented
+func ServeMuxRoutes(mux *http.ServeMux) RouteResolver {
+	return &serveMuxResolver{mux: mux}
+}
+
+func (r *ginResolver) ResolveRoute(req *http.Request) (string, []PathParam, bool) {
+	patterns := make([]string, 0)
+	for _, route := range r.engine.Routes() {
+		patterns = append(patterns, route.Method+" "+route.Path)
+	}
+	return bestRoute(patterns, req)
+}
+
+func (r *patternResolver) ResolveRoute(req *http.Request) (string, []PathParam, bool) {
+	return bestRoute(r.patterns, req)
+}
+
+func (r *serveMuxResolver) ResolveRoute(req *http.Request) (string, []PathParam, bool) {
+	_, pattern := r.mux.Handler(req)
+	if len(pattern) == 0 {
+		return "", nil, false
+	}
+
+	// Patterns look like "[HOST]/path"
+	if index := strings.Index(pattern, "/"); index > 0 {
+		pattern = pattern[index:]
+	}
+	return pattern, nil, true
+}
+
+// Static segments win over parameters
+func bestRoute(patterns []string, req *http.Request) (string, []PathParam, bool) {
+	best, bestScore := "", -1
+	var bestParams []PathParam
+
+	for _, pattern := range patterns {
+		route := pattern
+		if index := strings.Index(pattern, " "); index >= 0 {
+			if !strings.EqualFold(pattern[:index], req.Method) {
+				continue
+			}
+			route = strings.TrimSpace(pattern[index+1:])
+		}
+
+		params, ok := matchRoute(route, req.URL.Path)
+		if !ok {
+			continue
+		}
+		score := 0
+		for _, segment := range strings.Split(route, "/") {
+			if !isRouteParam(segment) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore, bestParams = route, score, params
+		}
+	}
+	return best, bestParams, bestScore >= 0
+}
+
+func isRouteParam(segment string) bool {
+	return strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") || strings.HasPrefix(segment, "{")
+}
+
+// Templates may use gin (:param, *param) and chi ({param}, {param:regex}, *) segments
+func matchRoute(template string, path string) ([]PathParam, bool) {
+	params := make([]PathParam, 0)
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range templateSegments {
+		if i > len(pathSegments) {
+			return nil, false
+		}
+
+		// Catch-all segments match the rest of the path
+		if strings.HasPrefix(segment, "*") {
+			if len(segment) > 1 {
+				params = append(params, PathParam{Key: segment[1:], Value: "/" + strings.Join(pathSegments[i:], "/")})
+			}
+			return params, true
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "...}") {
+			params = append(params, PathParam{Key: segment[1 : len(segment)-4], Value: strings.Join(pathSegments[i:], "/")})
+			return params, true
+		}
+
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			params = append(params, PathParam{Key: segment[1:], Value: pathSegments[i]})
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			name := segment[1 : len(segment)-1]
+			if index := strings.Index(name, ":"); index >= 0 {
+				pattern, err := regexp.Compile("^(?:" + name[index+1:] + ")$")
+				if err != nil || !pattern.MatchString(pathSegments[i]) {
+					return nil, false
+				}
+				name = name[:index]
+			}
+			params = append(params, PathParam{Key: name, Value: pathSegments[i]})
+		default:
+			if segment != pathSegments[i] {
+				return nil, false
+			}
+		}
+	}
+	if len(templateSegments) != len(pathSegments) {
+		return nil, false
+	}
+	return params, true
+}
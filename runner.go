@@ -0,0 +1,242 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hoisie/mustache"
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario is a list of requests executed against a deployed service, in order
+type Scenario struct {
+	Name      string            `json:"name" yaml:"name"`
+	Variables map[string]string `json:"variables" yaml:"variables"`
+	Steps     []ScenarioStep    `json:"steps" yaml:"steps"`
+}
+
+// ScenarioStep is a request with optional expectations. Without ExpectStatus any 2xx or 3xx status passes
+type ScenarioStep struct {
+	HttpRequest          `yaml:",inline"`
+	ExpectStatus         int    `json:"expectStatus" yaml:"expectStatus"`
+	ExpectResponseStatus string `json:"expectResponseStatus" yaml:"expectResponseStatus"`
+}
+
+// StepResult is the outcome of a single scenario step
+type StepResult struct {
+	Step     ScenarioStep
+	Exchange Exchange
+	Duration time.Duration
+	Err      error
+}
+
+// Runner executes scenarios, carrying variables and named responses from one step to the next
+type Runner struct {
+	BaseUrl   string
+	Client    *http.Client
+	variables map[string]interface{}
+	recording Recording
+}
+
+// LoadScenario reads a scenario from a .http, .json, .yaml or .yml file
+func LoadScenario(fileName string) (*Scenario, error) {
+	name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".http", ".rest":
+		httpFile, err := LoadHttpFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		scenario := httpFile.Scenario(name)
+		return &scenario, nil
+	case ".json", ".yaml", ".yml":
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		scenario := Scenario{}
+		if strings.ToLower(filepath.Ext(fileName)) == ".json" {
+			err = json.Unmarshal(content, &scenario)
+		} else {
+			err = yaml.Unmarshal(content, &scenario)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %v", fileName, err)
+		}
+		for i := range scenario.Steps {
+			scenario.Steps[i].Body = normalizeYaml(scenario.Steps[i].Body)
+		}
+		if len(scenario.Name) == 0 {
+			scenario.Name = name
+		}
+		return &scenario, nil
+	}
+	return nil, fmt.Errorf("unsupported scenario file: %s", fileName)
+}
+
+func (s *Scenario) step(name string) *ScenarioStep {
+	for i := range s.Steps {
+		if s.Steps[i].Name == name {
+			return &s.Steps[i]
+		}
+	}
+	return nil
+}
+
+func NewRunner(baseUrl string) *Runner {
+	return &Runner{
+		BaseUrl:   strings.TrimSuffix(baseUrl, "/"),
+		Client:    &http.Client{Timeout: time.Second * 10},
+		variables: make(map[string]interface{}),
+		recording: Recording{BaseUrl: baseUrl, Exchanges: make([]Exchange, 0)},
+	}
+}
+
+// Recording returns all exchanges performed by the runner so far
+func (r *Runner) Recording() *Recording {
+	return &r.recording
+}
+
+// Run executes all steps of a scenario. A failed step doesn't stop the scenario
+func (r *Runner) Run(scenario *Scenario) []StepResult {
+	for k, v := range scenario.Variables {
+		r.variables[k] = v
+	}
+	if len(r.BaseUrl) > 0 {
+		r.variables["baseUrl"] = r.BaseUrl
+	}
+
+	results := make([]StepResult, 0)
+	for _, step := range scenario.Steps {
+		results = append(results, r.runStep(step))
+	}
+	return results
+}
+
+func (r *Runner) runStep(step ScenarioStep) StepResult {
+	result := StepResult{Step: step}
+
+	request := step.HttpRequest
+	request.Path = r.render(request.Path)
+	if !strings.HasPrefix(request.Path, "http://") && !strings.HasPrefix(request.Path, "https://") {
+		request.Path = r.BaseUrl + request.Path
+	}
+	if request.Body != nil {
+		jsonDoc, err := json.MarshalIndent(request.Body, "", "\t")
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		request.Body = nil
+		request.Payload = string(jsonDoc)
+	}
+	request.Payload = r.render(request.Payload)
+	headers := make(map[string]string)
+	for k, v := range request.Headers {
+		headers[k] = r.render(v)
+	}
+	request.Headers = headers
+
+	req, err := newRemoteRequest(request)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	res, err := r.Client.Do(req)
+	if err != nil {
+		result.Err = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Exchange = Exchange{
+		Name:            step.Name,
+		Description:     step.Description,
+		Method:          req.Method,
+		Url:             req.URL.RequestURI(),
+		Route:           strings.Replace(step.Path, "{{baseUrl}}", "", 1),
+		RequestHeaders:  req.Header,
+		RequestBody:     request.Payload,
+		Status:          res.StatusCode,
+		ResponseHeaders: res.Header,
+		ResponseBody:    string(body),
+	}
+	r.recording.Exchanges = append(r.recording.Exchanges, result.Exchange)
+
+	var parsedBody interface{} = string(body)
+	var jsonBody interface{}
+	if err := json.Unmarshal(body, &jsonBody); err == nil {
+		parsedBody = jsonBody
+	}
+
+	if len(step.Name) > 0 {
+		responseHeaders := make(map[string]interface{})
+		for k := range res.Header {
+			responseHeaders[k] = res.Header.Get(k)
+		}
+		r.variables[step.Name] = map[string]interface{}{
+			"response": map[string]interface{}{"status": res.StatusCode, "headers": responseHeaders, "body": parsedBody},
+		}
+	}
+	for _, v := range step.ResponseVariables {
+		r.variables[v.Variable] = r.render("{{" + v.Expression + "}}")
+	}
+
+	if step.ExpectStatus != 0 {
+		if res.StatusCode != step.ExpectStatus {
+			result.Err = fmt.Errorf("unexpected status code %d, should be %d", res.StatusCode, step.ExpectStatus)
+			return result
+		}
+	} else if res.StatusCode < 200 || res.StatusCode >= 400 {
+		result.Err = fmt.Errorf("unexpected status code %d", res.StatusCode)
+		return result
+	}
+
+	if len(step.ExpectResponseStatus) > 0 {
+		response, ok := parsedBody.(map[string]interface{})
+		if !ok || response["Status"] != step.ExpectResponseStatus {
+			result.Err = fmt.Errorf("unexpected status: %v, should be %s", response["Status"], step.ExpectResponseStatus)
+		}
+	}
+	return result
+}
+
+func (r *Runner) render(template string) string {
+	if !strings.Contains(template, "{{") {
+		return template
+	}
+	return mustache.Render(template, r.variables)
+}
+
+func normalizeYaml(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for k, item := range v {
+			result[fmt.Sprintf("%v", k)] = normalizeYaml(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYaml(item)
+		}
+		return v
+	}
+	return value
+}
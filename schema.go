@@ -0,0 +1,199 @@
+package httptesting
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaField describes a field of a request body struct, taken from its Go type and tags:
+// `json:"name"`, `binding:"required"` or `validate:"required"` and `doc:"description"`
+type SchemaField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// JsonType is the OpenAPI type derived from the kind of the Go type, optionally followed by a format,
+	// arrays are prefixed with []: "string date-time", "[]integer"
+	JsonType    string `json:"jsonType,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// DescribeBody lists the fields of a struct body, nested fields are named `parent.child`, fields of slice elements `parent[].child`.
+// Bodies that are not structs, like gin.H, have no schema
+func DescribeBody(body interface{}) []SchemaField {
+	if body == nil {
+		return nil
+	}
+	t := reflect.TypeOf(body)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil
+	}
+	return describeStruct(t, "", make(map[reflect.Type]bool))
+}
+
+func describeStruct(t reflect.Type, prefix string, visited map[reflect.Type]bool) []SchemaField {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	fields := make([]SchemaField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+
+		jsonTag := field.Tag.Get("json")
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+			fields = append(fields, describeStruct(fieldType, prefix, visited)...)
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		fields = append(fields, SchemaField{
+			Name:        prefix + name,
+			Type:        field.Type.String(),
+			JsonType:    jsonTypeOf(field.Type),
+			Required:    hasRequiredTag(field.Tag.Get("binding")) || hasRequiredTag(field.Tag.Get("validate")),
+			Description: field.Tag.Get("doc"),
+		})
+
+		switch {
+		case fieldType.Kind() == reflect.Struct && fieldType != timeType:
+			fields = append(fields, describeStruct(fieldType, prefix+name+".", visited)...)
+		case fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array:
+			elem := fieldType.Elem()
+			for elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct && elem != timeType {
+				fields = append(fields, describeStruct(elem, prefix+name+"[].", visited)...)
+			}
+		}
+	}
+	return fields
+}
+
+func hasRequiredTag(tag string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func openApiSchemaOfFields(fields []SchemaField) map[string]interface{} {
+	root := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	schemas := map[string]map[string]interface{}{"": root}
+
+	for _, field := range fields {
+		parentName := ""
+		name := field.Name
+		if index := strings.LastIndex(field.Name, "."); index >= 0 {
+			parentName = field.Name[:index]
+			name = field.Name[index+1:]
+		}
+
+		parent, ok := schemas[parentName]
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(parentName, "[]") {
+			// Fields of slice elements belong to the items schema
+			parent = parent["items"].(map[string]interface{})
+		}
+
+		schema := openApiSchemaOfJsonType(field.JsonType)
+		if len(field.Description) > 0 {
+			schema["description"] = field.Description
+		}
+
+		properties, ok := parent["properties"].(map[string]interface{})
+		if !ok {
+			properties = make(map[string]interface{})
+			parent["properties"] = properties
+		}
+		properties[name] = schema
+		if field.Required {
+			required, _ := parent["required"].([]string)
+			parent["required"] = append(required, name)
+		}
+
+		schemas[field.Name] = schema
+		if schema["type"] == "array" {
+			schemas[field.Name+"[]"] = schema
+		}
+	}
+	return root
+}
+
+// Named types like `type Role string` follow their kind
+func jsonTypeOf(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return "string date-time"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings, byte arrays are not
+			return "string byte"
+		}
+		return "[]" + jsonTypeOf(t.Elem())
+	case reflect.Array:
+		return "[]" + jsonTypeOf(t.Elem())
+	case reflect.Interface:
+		return ""
+	}
+	return "object"
+}
+
+func openApiSchemaOfJsonType(jsonType string) map[string]interface{} {
+	if strings.HasPrefix(jsonType, "[]") {
+		return map[string]interface{}{"type": "array", "items": openApiSchemaOfJsonType(jsonType[2:])}
+	}
+	parts := strings.Fields(jsonType)
+	schema := make(map[string]interface{})
+	if len(parts) > 0 {
+		schema["type"] = parts[0]
+	}
+	if len(parts) > 1 {
+		schema["format"] = parts[1]
+	}
+	return schema
+}
@@ -0,0 +1,668 @@
+package httptesting
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/elliotchance/orderedmap"
+)
+
+// SqlBuilder builds INSERT, UPDATE, DELETE and SELECT statements in the syntax of a Dialect, keeping track of the arguments
+type SqlBuilder struct {
+	dialect                 Dialect
+	quoteIdentifiers        bool
+	safe                    bool
+	insertFlag              bool
+	updateFlag              bool
+	deleteFlag              bool
+	selectFlag              bool
+	tableName               string
+	setParams               *orderedmap.OrderedMap
+	setExplicitParams       *orderedmap.OrderedMap
+	whereParams             *orderedmap.OrderedMap
+	whereParamsRelationship *orderedmap.OrderedMap
+	orderByParams           *orderedmap.OrderedMap
+	tableAlias              string
+	joins                   []*joinClause
+	whereConditions         []Condition
+	manyColumns             []string
+	manyRows                [][]interface{}
+	onConflict              *conflictClause
+	groupByParams           []string
+	havingConditions        []Condition
+	withQueries             []commonTableExpression
+	recursive               bool
+	fromSubquery            *SqlBuilder
+	unions                  []union
+	parent                  *SqlBuilder
+	source                  *SqlBuilder
+	argumentNames           []string
+	argumentValues          []interface{}
+	returningParams         []string
+	limit                   int
+	offset                  int
+	totalCountAlias         string
+	err                     error
+	buffer                  StringBuilder
+}
+
+// PostgresSqlBuilder is the Postgres flavour of SqlBuilder, its zero value is ready to use
+type PostgresSqlBuilder = SqlBuilder
+
+// PostgresSqlBuilder ;= PostgresSqlBuilder{}
+// PostgresSqlBuilder.Insert("table1").Set(map[string]interface{}{"param1": 1, "param2": true}).String()
+
+// NewSqlBuilder returns a builder for a dialect, e.g. NewSqlBuilder(Sqlite)
+func NewSqlBuilder(dialect Dialect) *SqlBuilder {
+	return &SqlBuilder{dialect: dialect}
+}
+
+// Dialect returns the dialect statements are built in, Postgres unless specified
+func (s *SqlBuilder) Dialect() Dialect {
+	if s.dialect == nil {
+		return Postgres
+	}
+	return s.dialect
+}
+
+// QuotedIdentifiers makes the builder quote table and column names, e.g. "order" or `order`
+func (s *SqlBuilder) QuotedIdentifiers() *SqlBuilder {
+	s.quoteIdentifiers = true
+	return s
+}
+
+// Qualified names are quoted part by part, so is the column of aggregates like count(id), in safe mode as well
+func (s *SqlBuilder) identifier(name string) string {
+	s.checkIdentifier(name)
+	if name == "*" {
+		return name
+	}
+	if expressionPattern.MatchString(name) {
+		if !s.quoteIdentifiers && !s.safeMode() {
+			return name
+		}
+		open, close := strings.Index(name, "("), strings.Index(name, ")")
+		return name[:open+1] + s.quote(name[open+1:close]) + name[close:]
+	}
+	if !s.quoteIdentifiers {
+		return name
+	}
+	if !identifierPattern.MatchString(name) {
+		s.err = errors.New("Identifier " + name + " can not be quoted")
+		return name
+	}
+	return s.quote(name)
+}
+
+func (s *SqlBuilder) quote(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part != "*" {
+			parts[i] = s.Dialect().QuoteIdentifier(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (s *SqlBuilder) Insert(tableName string) *SqlBuilder {
+	s.tableName = tableName
+	s.insertFlag = true
+	s.setParams = orderedmap.NewOrderedMap()
+	s.setExplicitParams = orderedmap.NewOrderedMap()
+	s.whereParams = orderedmap.NewOrderedMap()
+	s.whereParamsRelationship = orderedmap.NewOrderedMap()
+
+	if len(s.tableName) == 0 {
+		s.err = errors.New("Table name has to be specified")
+	}
+
+	return s
+}
+
+func (s *SqlBuilder) Delete(tableName string) *SqlBuilder {
+	s.tableName = tableName
+	s.deleteFlag = true
+	s.whereParams = orderedmap.NewOrderedMap()
+	s.whereParamsRelationship = orderedmap.NewOrderedMap()
+
+	if len(s.tableName) == 0 {
+		s.err = errors.New("Table name has to be specified")
+	}
+	return s
+}
+
+func (s *SqlBuilder) Update(tableName string) *SqlBuilder {
+	s.tableName = tableName
+	s.updateFlag = true
+	s.setParams = orderedmap.NewOrderedMap()
+	s.setExplicitParams = orderedmap.NewOrderedMap()
+	s.whereParams = orderedmap.NewOrderedMap()
+	s.whereParamsRelationship = orderedmap.NewOrderedMap()
+
+	if len(s.tableName) == 0 {
+		s.err = errors.New("Table name has to be specified")
+	}
+
+	return s
+}
+
+func (s *SqlBuilder) Select(tableName string) *SqlBuilder {
+
+	s.tableName = strings.TrimSpace(tableName)
+	s.selectFlag = true
+	s.whereParams = orderedmap.NewOrderedMap()
+	s.whereParamsRelationship = orderedmap.NewOrderedMap()
+	s.orderByParams = orderedmap.NewOrderedMap()
+
+	if len(s.tableName) == 0 {
+		s.err = errors.New("Table name has to be specified")
+	}
+
+	return s
+}
+
+// Join adds a raw join statement, see InnerJoin and LeftJoin for joins binding arguments
+func (s *SqlBuilder) Join(joinStatement Raw) *SqlBuilder {
+	if len(strings.TrimSpace(string(joinStatement))) > 0 {
+		s.joins = append(s.joins, &joinClause{raw: string(joinStatement)})
+	}
+	return s
+}
+
+func (s *SqlBuilder) Where(params *orderedmap.OrderedMap) *SqlBuilder {
+	s.whereParams = params
+	for _, k := range params.Keys() {
+		s.whereParamsRelationship.Set(k, "=")
+	}
+	return s
+}
+
+func (s *SqlBuilder) WhereArg(param string, value interface{}) *SqlBuilder {
+	if s.whereParams == nil || s.whereParamsRelationship == nil {
+		s.err = errors.New("In this mode usage of WhereArg is not appropriate")
+	} else {
+		s.whereParams.Set(param, value)
+		s.whereParamsRelationship.Set(param, "=")
+	}
+	return s
+}
+
+// WhereExpr adds conditions to the WHERE clause, e.g. WhereExpr(Or(Equal("status", "new"), Cond("created", ">=", since)))
+func (s *SqlBuilder) WhereExpr(conditions ...Condition) *SqlBuilder {
+	if s.whereParams == nil || s.whereParamsRelationship == nil || s.insertFlag {
+		s.err = errors.New("In this mode usage of WhereExpr is not appropriate")
+	} else {
+		s.whereConditions = append(s.whereConditions, conditions...)
+	}
+	return s
+}
+
+func (s *SqlBuilder) WhereIn(column string, values interface{}) *SqlBuilder {
+	return s.WhereExpr(In(column, values))
+}
+
+func (s *SqlBuilder) WhereNotIn(column string, values interface{}) *SqlBuilder {
+	return s.WhereExpr(NotIn(column, values))
+}
+
+func (s *SqlBuilder) WhereNull(column string) *SqlBuilder {
+	return s.WhereExpr(IsNull(column))
+}
+
+func (s *SqlBuilder) WhereNotNull(column string) *SqlBuilder {
+	return s.WhereExpr(IsNotNull(column))
+}
+
+func (s *SqlBuilder) WhereBetween(column string, low interface{}, high interface{}) *SqlBuilder {
+	return s.WhereExpr(Between(column, low, high))
+}
+
+func (s *SqlBuilder) WhereLike(column string, pattern string) *SqlBuilder {
+	return s.WhereExpr(Like(column, pattern))
+}
+
+func (s *SqlBuilder) WhereILike(column string, pattern string) *SqlBuilder {
+	return s.WhereExpr(ILike(column, pattern))
+}
+
+func (s *SqlBuilder) All() *SqlBuilder {
+	if s.whereParams == nil || s.whereParamsRelationship == nil {
+		s.err = errors.New("In this mode usage of All is not appropriate")
+	} else {
+		s.whereParamsRelationship.Set("*", "*")
+	}
+	return s
+}
+
+func (s *SqlBuilder) WhereArgRelationship(param string, relationship string, value interface{}) *SqlBuilder {
+	if s.whereParams == nil || s.whereParamsRelationship == nil {
+		s.err = errors.New("In this mode usage of WhereArgRelationship is not appropriate")
+	} else {
+		relationship = strings.TrimSpace(relationship)
+		if len(relationship) == 0 {
+			s.err = errors.New("Relationship is not defined")
+		}
+		s.whereParams.Set(param, value)
+		s.whereParamsRelationship.Set(param, relationship)
+	}
+	return s
+}
+
+func (s *SqlBuilder) OrderBy(param string, direction string) *SqlBuilder {
+	if s.whereParams == nil || !s.selectFlag {
+		s.err = errors.New("In this mode usage of OrderBy is not appropriate")
+	} else {
+		param = strings.TrimSpace(param)
+		direction = strings.TrimSpace(direction)
+		if len(param) == 0 {
+			s.err = errors.New("OrderBy Param is not defined")
+		}
+		if len(direction) == 0 {
+			s.err = errors.New("OrderBy direction is not defined")
+		} else if normalized, err := orderDirection(direction); err != nil {
+			s.err = err
+		} else {
+			direction = normalized
+		}
+		s.orderByParams.Set(param, direction)
+	}
+	return s
+}
+
+func (s *SqlBuilder) Set(params *orderedmap.OrderedMap) *SqlBuilder {
+	s.setParams = params
+	return s
+}
+
+func (s *SqlBuilder) SetArg(param string, value interface{}) *SqlBuilder {
+	if s.setParams == nil {
+		s.err = errors.New("In this mode usage of SetArg is not appropriate")
+	} else {
+		s.setParams.Set(param, value)
+	}
+	return s
+}
+
+// SetExplicitArg sets a column to a SQL expression, e.g. SetExplicitArg("created", "now()")
+func (s *SqlBuilder) SetExplicitArg(param string, value Raw) *SqlBuilder {
+	if s.setExplicitParams == nil {
+		s.err = errors.New("In this mode usage of SetExplicitArg is not appropriate")
+	} else {
+		s.setExplicitParams.Set(param, string(value))
+	}
+	return s
+}
+
+func (s *SqlBuilder) Returning(params ...string) *SqlBuilder {
+	s.returningParams = params
+	return s
+}
+
+func (s *SqlBuilder) Limit(limit int) *SqlBuilder {
+	s.limit = limit
+	return s
+}
+
+// Subqueries bind into the statement they are part of, Raw values are written as they are
+func (s *SqlBuilder) bind(name string, value interface{}) string {
+	if raw, ok := value.(Raw); ok {
+		return string(raw)
+	}
+	if s.parent != nil {
+		return s.parent.bind(name, value)
+	}
+	s.argumentNames = append(s.argumentNames, name)
+	s.argumentValues = append(s.argumentValues, value)
+	return s.Dialect().Placeholder(len(s.argumentValues))
+}
+
+func buildValuesClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+	sb1 := StringBuilder{}
+
+	if s.setParams.Len() == 0 {
+		s.err = errors.New("No insertion parameters passed")
+	}
+
+	sb.Write("(")
+	sb1.Write("VALUES (")
+	index := 1
+	for _, name := range s.setParams.Keys() {
+		value, ok := s.setParams.Get(name)
+		if !ok {
+			continue
+		}
+		if index > 1 {
+			sb.Write(", ")
+			sb1.Write(", ")
+		}
+		sb.Write(s.identifier(name.(string)))
+		sb1.Write(s.bind(name.(string), value))
+		index++
+	}
+	for _, name := range s.setExplicitParams.Keys() {
+		value, ok := s.setExplicitParams.Get(name)
+		if !ok {
+			continue
+		}
+		if index > 1 {
+			sb.Write(", ")
+			sb1.Write(", ")
+		}
+		sb.Write(s.identifier(name.(string)))
+		sb1.Write(value.(string))
+		index++
+	}
+	sb.Write(") ")
+	sb1.Write(")")
+	sb.Write(sb1.String())
+	return sb.String()
+}
+
+func buildSetClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if s.setParams.Len() == 0 {
+		s.err = errors.New("No update parameters passed")
+	}
+
+	index := 1
+	for _, name := range s.setParams.Keys() {
+		value, ok := s.setParams.Get(name)
+		if !ok {
+			continue
+		}
+
+		if index > 1 {
+			sb.Write(",")
+		}
+
+		sb.Write(s.identifier(name.(string)), "=", s.bind(name.(string), value))
+		index++
+	}
+	for _, name := range s.setExplicitParams.Keys() {
+		value, ok := s.setExplicitParams.Get(name)
+		if !ok {
+			continue
+		}
+
+		if index > 1 {
+			sb.Write(",")
+		}
+
+		sb.Write(s.identifier(name.(string)), "=", value.(string))
+		index++
+
+	}
+	return sb.String()
+}
+
+func buildWhereClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if val, ok := s.whereParamsRelationship.Get("*"); ok {
+		// Returning all matches, as .All() was applied, column arguments will be ignored.
+		// Conditions still apply, e.g. the keyset of SeekAfter on an unfiltered list
+		if val != "*" {
+			s.err = errors.New(".All() was not properly applied")
+		}
+		if len(s.whereConditions) == 0 {
+			sb.Write("1=1")
+		} else {
+			sb.Write(renderConditions(s, s.whereConditions))
+		}
+		return sb.String()
+	}
+
+	if s.whereParams.Len() == 0 && len(s.whereConditions) == 0 {
+		s.err = errors.New("Where clause has to be specified")
+	}
+
+	// Column arguments go first, then conditions in the order they were added
+	conditions := make([]Condition, 0, s.whereParams.Len()+len(s.whereConditions))
+	for _, name := range s.whereParams.Keys() {
+		value, ok := s.whereParams.Get(name)
+		if !ok {
+			s.err = errors.New("Incomplete where arguments")
+			continue
+		}
+
+		relationship, ok := s.whereParamsRelationship.Get(name.(string))
+		if !ok {
+			s.err = errors.New("Incomplete where relationships")
+			continue
+		}
+		conditions = append(conditions, Cond(name.(string), relationship.(string), value))
+	}
+	conditions = append(conditions, s.whereConditions...)
+
+	sb.Write(renderConditions(s, conditions))
+	return sb.String()
+}
+
+func buildOrderByClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+	if s.orderByParams.Len() > 0 {
+		sb.Write(" ORDER BY ")
+		for index, name := range s.orderByParams.Keys() {
+			value, ok := s.orderByParams.Get(name)
+			if !ok {
+				s.err = errors.New("Incomplete order by arguments")
+				continue
+			}
+			if index > 0 {
+				sb.Write(", ")
+			}
+			sb.Write(s.identifier(name.(string)), " ", value.(string))
+		}
+
+	}
+	return sb.String()
+}
+
+func buildReturnClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if len(s.returningParams) > 0 {
+		for i, name := range s.returningParams {
+			if i > 0 {
+				sb.Write(", ")
+			}
+			sb.Write(s.identifier(name))
+		}
+	}
+	return sb.String()
+}
+
+func buildSelectClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if len(s.returningParams) == 0 {
+		s.err = errors.New("Returning params have to be specified")
+	}
+
+	if len(s.returningParams) > 0 {
+		for i, name := range s.returningParams {
+			if i > 0 {
+				sb.Write(", ")
+			}
+			sb.Write(s.identifier(name))
+		}
+	}
+	if len(s.totalCountAlias) > 0 {
+		sb.Write(", count(*) OVER () AS ", s.identifier(s.totalCountAlias))
+	}
+	return sb.String()
+}
+
+func buildLimitClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+
+	if !s.selectFlag {
+		s.err = errors.New("Limit clause only supported for select")
+	}
+
+	sb.Write(s.Dialect().LimitOffset(s.limit, s.offset))
+	return sb.String()
+}
+
+// Build renders the statement with its arguments. It can be called repeatedly, every call starts from scratch,
+// errors found while rendering are returned without being kept in the builder
+func (s *SqlBuilder) Build() (string, []interface{}, []string, error) {
+	configErr := s.err
+	defer func() { s.err = configErr }()
+
+	s.buffer = StringBuilder{}
+	s.argumentNames = nil
+	s.argumentValues = nil
+	s.buffer.Write(s.statement())
+
+	if s.manyColumns != nil && len(s.argumentValues) > s.Dialect().MaxPlaceholders() {
+		s.err = errors.New("Too many arguments for a single statement, use BuildBatches")
+	}
+	if !s.selectFlag && len(s.returningParams) > 0 && !s.Dialect().SupportsReturning() {
+		s.err = errors.New("RETURNING is not supported by " + s.Dialect().Name())
+	}
+
+	if s.err != nil {
+		return "", nil, nil, s.err
+	}
+	returning := make([]string, 0, len(s.returningParams)+1)
+	for _, name := range s.returningParams {
+		returning = append(returning, returnedName(name))
+	}
+	if s.selectFlag && len(s.totalCountAlias) > 0 {
+		returning = append(returning, s.totalCountAlias)
+	}
+	return s.buffer.String(), s.argumentValues, returning, s.err
+}
+
+func (s *SqlBuilder) statement() string {
+	sb := StringBuilder{}
+	sb.Write(buildWithClause(s))
+
+	if s.selectFlag {
+		sb.Write("SELECT ", buildSelectClause(s), " FROM ", buildFromClause(s), " ")
+		if len(s.tableAlias) > 0 {
+			sb.Write(s.identifier(s.tableAlias), " ")
+		}
+		sb.Write(buildJoin(s))
+		sb.Write("WHERE ")
+		sb.Write(buildWhereClause(s))
+		sb.Write(buildGroupByClause(s))
+		sb.Write(buildOrderByClause(s))
+		sb.Write(buildLimitClause(s))
+		sb.Write(buildUnionClause(s))
+	} else if s.insertFlag {
+		sb.Write("INSERT INTO ", s.identifier(s.tableName), " ")
+		if s.manyColumns != nil {
+			sb.Write(buildManyValuesClause(s))
+		} else {
+			sb.Write(buildValuesClause(s))
+		}
+		if s.onConflict != nil {
+			sb.Write(buildUpsertClause(s))
+		}
+		if len(s.returningParams) > 0 {
+			sb.Write(" RETURNING ")
+			sb.Write(buildReturnClause(s))
+		}
+	} else if s.updateFlag {
+
+		sb.Write("UPDATE ", s.identifier(s.tableName), " SET ")
+		sb.Write(buildSetClause(s))
+		sb.Write(" WHERE ")
+		sb.Write(buildWhereClause(s))
+		if len(s.returningParams) > 0 {
+			sb.Write(" RETURNING ")
+			sb.Write(buildReturnClause(s))
+		}
+	} else if s.deleteFlag {
+		sb.Write("DELETE FROM ", s.identifier(s.tableName), " ")
+		sb.Write("WHERE ")
+		sb.Write(buildWhereClause(s))
+		if len(s.returningParams) > 0 {
+			sb.Write(" RETURNING ")
+			sb.Write(buildReturnClause(s))
+		}
+	}
+	return sb.String()
+}
+
+func (s *SqlBuilder) Exec(db SqlExecutor) (sql.Result, error) {
+	query, inArgs, _, err := s.Build()
+	if err != nil {
+		return nil, err
+	}
+	return db.Exec(query, inArgs...)
+}
+
+// Query builds and executes the statement, rows have to be closed by the caller
+func (s *SqlBuilder) Query(db SqlExecutor) (*sql.Rows, error) {
+	query, inArgs, _, err := s.Build()
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(query, inArgs...)
+}
+
+// QueryToMap builds and executes the statement, returning at most limit rows, 0 for all of them
+func (s *SqlBuilder) QueryToMap(db SqlExecutor, limit int) ([]map[string]interface{}, error) {
+	rows, err := s.Query(db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanToMap(rows, limit)
+}
+
+func ScanOneToMap(rows *sql.Rows) (map[string]interface{}, error) {
+	res, err := ScanToMap(rows, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < 1 {
+		return nil, errors.New("No matches found")
+	}
+	return res[0], nil
+}
+
+func ScanToMap(rows *sql.Rows, limit int) ([]map[string]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		columns := make([]interface{}, len(cols))
+		columnPointers := make([]interface{}, len(cols))
+		for i, _ := range columns {
+			columnPointers[i] = &columns[i]
+		}
+
+		if err := rows.Scan(columnPointers...); err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]interface{})
+		for i, colName := range cols {
+			val := columnPointers[i].(*interface{})
+			m[colName] = *val
+		}
+
+		res = append(res, m)
+		if limit != 0 && len(res) >= limit {
+			break
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return res, nil
+}
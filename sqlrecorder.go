@@ -0,0 +1,322 @@
+package httptesting
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ExecutedQuery is a statement run through a database opened with a SqlRecorder
+type ExecutedQuery struct {
+	Query    string        `json:"query"`
+	Args     []interface{} `json:"args,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"-"`
+}
+
+// SqlRecorder wraps database/sql drivers and keeps track of the statements they run. Statements run with the
+// context of a documented request, e.g. `db.QueryContext(c.Request.Context(), ...)`, are documented with its exchange
+type SqlRecorder struct {
+	lock    sync.Mutex
+	queries []ExecutedQuery
+}
+
+// NewSqlRecorder returns a recorder, wrap a driver with Open, Connector or Driver
+func NewSqlRecorder() *SqlRecorder {
+	return &SqlRecorder{queries: make([]ExecutedQuery, 0)}
+}
+
+// Open opens a database like sql.Open does, with the driver wrapped
+func (r *SqlRecorder) Open(driverName string, dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	if driverContext, ok := d.(driver.DriverContext); ok {
+		connector, err := driverContext.OpenConnector(dataSourceName)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(r.Connector(connector)), nil
+	}
+	return sql.OpenDB(&recordingConnector{recorder: r, driver: d, dsn: dataSourceName}), nil
+}
+
+// Connector wraps a connector, for sql.OpenDB
+func (r *SqlRecorder) Connector(connector driver.Connector) driver.Connector {
+	return &recordingConnector{recorder: r, connector: connector}
+}
+
+// Driver wraps a driver, e.g. to register it under another name with sql.Register
+func (r *SqlRecorder) Driver(d driver.Driver) driver.Driver {
+	return &recordingDriver{recorder: r, driver: d}
+}
+
+func (r *SqlRecorder) Queries() []ExecutedQuery {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]ExecutedQuery{}, r.queries...)
+}
+
+// Reset forgets the statements run so far, e.g. before performing the request whose queries are counted
+func (r *SqlRecorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.queries = make([]ExecutedQuery, 0)
+}
+
+func (r *SqlRecorder) record(ctx context.Context, query string, args []driver.NamedValue, started time.Time, err error) {
+	if ctx != nil && ctx.Value(unrecordedKey{}) != nil {
+		return
+	}
+	executed := ExecutedQuery{Query: query, Duration: time.Since(started)}
+	for _, arg := range args {
+		executed.Args = append(executed.Args, columnValue(arg.Value))
+	}
+	if err != nil && err != driver.ErrSkip {
+		executed.Error = err.Error()
+	}
+
+	r.lock.Lock()
+	r.queries = append(r.queries, executed)
+	r.lock.Unlock()
+
+	if ctx == nil {
+		return
+	}
+	if capture, ok := ctx.Value(exchangeCaptureKey{}).(*exchangeCapture); ok {
+		capture.addQuery(executed)
+	}
+}
+
+// AssertQueryCount checks the number of statements run since the recorder was reset, e.g. to catch N+1 queries
+func AssertQueryCount(t testing.TB, recorder *SqlRecorder, expectedCount int) []ExecutedQuery {
+	t.Helper()
+	queries := recorder.Queries()
+	if len(queries) != expectedCount {
+		t.Errorf("Unexpected number of queries: %d, should be %d\n", len(queries), expectedCount)
+		for _, query := range queries {
+			t.Logf("\t%s %v\n", query.Query, query.Args)
+		}
+	}
+	return queries
+}
+
+func (e *exchangeCapture) addQuery(query ExecutedQuery) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.exchange.Queries = append(e.exchange.Queries, query)
+}
+
+type recordingDriver struct {
+	recorder *SqlRecorder
+	driver   driver.Driver
+}
+
+func (d *recordingDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{recorder: d.recorder, conn: conn}, nil
+}
+
+type recordingConnector struct {
+	recorder  *SqlRecorder
+	connector driver.Connector
+	driver    driver.Driver
+	dsn       string
+}
+
+func (c *recordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	var err error
+	if c.connector != nil {
+		conn, err = c.connector.Connect(ctx)
+	} else {
+		conn, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{recorder: c.recorder, conn: conn}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	if c.connector != nil {
+		return &recordingDriver{recorder: c.recorder, driver: c.connector.Driver()}
+	}
+	return &recordingDriver{recorder: c.recorder, driver: c.driver}
+}
+
+type recordingConn struct {
+	recorder *SqlRecorder
+	conn     driver.Conn
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *recordingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &recordingStmt{recorder: c.recorder, stmt: stmt, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recordingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	started := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.recorder.record(ctx, query, args, started, err)
+	}
+	return result, err
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	started := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.recorder.record(ctx, query, args, started, err)
+	}
+	return rows, err
+}
+
+func (c *recordingConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *recordingConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *recordingConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type recordingStmt struct {
+	recorder *SqlRecorder
+	stmt     driver.Stmt
+	query    string
+}
+
+func (s *recordingStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *recordingStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *recordingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	started := time.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			result, err = s.stmt.Exec(values)
+		}
+	}
+	s.recorder.record(ctx, s.query, args, started, err)
+	return result, err
+}
+
+func (s *recordingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	started := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+	s.recorder.record(ctx, s.query, args, started, err)
+	return rows, err
+}
+
+func (s *recordingStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(values []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(values))
+	for i, value := range values {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: value}
+	}
+	return named
+}
+
+func plainValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, value := range named {
+		if len(value.Name) > 0 {
+			return nil, errors.New("Named arguments are not supported by the wrapped driver")
+		}
+		values[i] = value.Value
+	}
+	return values, nil
+}
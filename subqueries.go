@@ -0,0 +1,158 @@
+package httptesting
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/elliotchance/orderedmap"
+)
+
+type commonTableExpression struct {
+	name  string
+	query *SqlBuilder
+}
+
+type union struct {
+	all   bool
+	query *SqlBuilder
+}
+
+type exists struct {
+	query *SqlBuilder
+	not   bool
+}
+
+// With adds a common table expression, name may list columns, e.g. "totals(customerid, amount)"
+func (s *SqlBuilder) With(name string, query *SqlBuilder) *SqlBuilder {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || query == nil {
+		s.err = errors.New("Common table expressions need a name and a query")
+		return s
+	}
+	s.withQueries = append(s.withQueries, commonTableExpression{name: name, query: query})
+	return s
+}
+
+// WithRecursive adds a common table expression which may refer to itself, usually a query with UnionAll
+func (s *SqlBuilder) WithRecursive(name string, query *SqlBuilder) *SqlBuilder {
+	s.recursive = true
+	return s.With(name, query)
+}
+
+// SelectFrom selects from a subquery under an alias
+func (s *SqlBuilder) SelectFrom(query *SqlBuilder, alias string) *SqlBuilder {
+	s.selectFlag = true
+	s.fromSubquery = query
+	s.tableAlias = strings.TrimSpace(alias)
+	s.whereParams = orderedmap.NewOrderedMap()
+	s.whereParamsRelationship = orderedmap.NewOrderedMap()
+	s.orderByParams = orderedmap.NewOrderedMap()
+
+	if query == nil {
+		s.err = errors.New("Subquery has to be specified")
+	}
+	if len(s.tableAlias) == 0 {
+		s.err = errors.New("Subqueries in FROM need an alias")
+	}
+	return s
+}
+
+// Union appends the rows of another select, without duplicates
+func (s *SqlBuilder) Union(query *SqlBuilder) *SqlBuilder {
+	return s.addUnion(false, query)
+}
+
+func (s *SqlBuilder) UnionAll(query *SqlBuilder) *SqlBuilder {
+	return s.addUnion(true, query)
+}
+
+func (s *SqlBuilder) addUnion(all bool, query *SqlBuilder) *SqlBuilder {
+	if !s.selectFlag || query == nil || !query.selectFlag {
+		s.err = errors.New("Unions are only supported between selects")
+		return s
+	}
+	s.unions = append(s.unions, union{all: all, query: query})
+	return s
+}
+
+func Exists(query *SqlBuilder) Condition {
+	return &exists{query: query}
+}
+
+func NotExists(query *SqlBuilder) Condition {
+	return &exists{query: query, not: true}
+}
+
+func (c *exists) render(s *SqlBuilder) string {
+	if c.not {
+		return "NOT EXISTS (" + s.subquery(c.query) + ")"
+	}
+	return "EXISTS (" + s.subquery(c.query) + ")"
+}
+
+// A copy is rendered, builders shared by clones of a base query are never written to
+func (s *SqlBuilder) subquery(query *SqlBuilder) string {
+	for outer := s; outer != nil; outer = outer.parent {
+		if outer == query || (outer.source != nil && outer.source == query) {
+			s.err = errors.New("A builder can not be its own subquery")
+			return ""
+		}
+	}
+	if query == nil {
+		s.err = errors.New("Subquery has to be specified")
+		return ""
+	}
+
+	// Rendering errors of the copy belong to the outer statement
+	rendered := *query
+	rendered.parent = s
+	rendered.source = query
+	statement := rendered.statement()
+	if rendered.err != nil && s.err == nil {
+		s.err = rendered.err
+	}
+	return statement
+}
+
+func buildWithClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+	if len(s.withQueries) == 0 {
+		return sb.String()
+	}
+
+	sb.Write("WITH ")
+	if s.recursive {
+		sb.Write("RECURSIVE ")
+	}
+	for i, cte := range s.withQueries {
+		if i > 0 {
+			sb.Write(", ")
+		}
+		if (s.safeMode() || s.quoteIdentifiers) && !cteNamePattern.MatchString(cte.name) {
+			s.err = errors.New("Identifier " + cte.name + " is not a valid common table expression name")
+		}
+		sb.Write(cte.name, " AS (", s.subquery(cte.query), ")")
+	}
+	sb.Write(" ")
+	return sb.String()
+}
+
+func buildFromClause(s *SqlBuilder) string {
+	if s.fromSubquery != nil {
+		return "(" + s.subquery(s.fromSubquery) + ")"
+	}
+	return s.identifier(s.tableName)
+}
+
+func buildUnionClause(s *SqlBuilder) string {
+	sb := StringBuilder{}
+	for _, u := range s.unions {
+		if u.all {
+			sb.Write(" UNION ALL ")
+		} else {
+			sb.Write(" UNION ")
+		}
+		sb.Write(s.subquery(u.query))
+	}
+	return sb.String()
+}
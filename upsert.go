@@ -0,0 +1,142 @@
+package httptesting
+
+import (
+	"errors"
+
+	"github.com/elliotchance/orderedmap"
+)
+
+// ExcludedValue refers to the value a conflicting INSERT proposed for a column, EXCLUDED.column in Postgres
+type ExcludedValue struct {
+	Column string
+}
+
+// Excluded is used as a DoUpdateSetArg value, e.g. DoUpdateSetArg("name", Excluded("name"))
+func Excluded(column string) ExcludedValue {
+	return ExcludedValue{Column: column}
+}
+
+type conflictClause struct {
+	columns     []string
+	where       []Condition
+	doNothing   bool
+	setParams   *orderedmap.OrderedMap
+	updateWhere []Condition
+}
+
+// OnConflict starts the conflict handling of an INSERT, columns make up the unique constraint.
+// It has to be followed by DoNothing or DoUpdateSet
+func (s *SqlBuilder) OnConflict(columns ...string) *SqlBuilder {
+	if !s.insertFlag {
+		s.err = errors.New("In this mode usage of OnConflict is not appropriate")
+		return s
+	}
+	s.onConflict = &conflictClause{columns: columns, setParams: orderedmap.NewOrderedMap()}
+	return s
+}
+
+// OnConflictWhere is the predicate of a partial unique index
+func (s *SqlBuilder) OnConflictWhere(conditions ...Condition) *SqlBuilder {
+	if s.onConflict == nil {
+		s.err = errors.New("OnConflictWhere has to follow OnConflict")
+		return s
+	}
+	s.onConflict.where = append(s.onConflict.where, conditions...)
+	return s
+}
+
+func (s *SqlBuilder) DoNothing() *SqlBuilder {
+	if s.onConflict == nil {
+		s.err = errors.New("DoNothing has to follow OnConflict")
+		return s
+	}
+	s.onConflict.doNothing = true
+	return s
+}
+
+// DoUpdateSet updates existing rows, values may be Excluded(column)
+func (s *SqlBuilder) DoUpdateSet(params *orderedmap.OrderedMap) *SqlBuilder {
+	if s.onConflict == nil {
+		s.err = errors.New("DoUpdateSet has to follow OnConflict")
+		return s
+	}
+	for _, k := range params.Keys() {
+		value, _ := params.Get(k)
+		s.onConflict.setParams.Set(k, value)
+	}
+	return s
+}
+
+func (s *SqlBuilder) DoUpdateSetArg(param string, value interface{}) *SqlBuilder {
+	if s.onConflict == nil {
+		s.err = errors.New("DoUpdateSetArg has to follow OnConflict")
+		return s
+	}
+	s.onConflict.setParams.Set(param, value)
+	return s
+}
+
+// DoUpdateSetExcluded overwrites columns of existing rows with the values the INSERT proposed
+func (s *SqlBuilder) DoUpdateSetExcluded(columns ...string) *SqlBuilder {
+	for _, column := range columns {
+		s.DoUpdateSetArg(column, Excluded(column))
+	}
+	return s
+}
+
+// DoUpdateWhere restricts which existing rows are updated
+func (s *SqlBuilder) DoUpdateWhere(conditions ...Condition) *SqlBuilder {
+	if s.onConflict == nil {
+		s.err = errors.New("DoUpdateWhere has to follow OnConflict")
+		return s
+	}
+	s.onConflict.updateWhere = append(s.onConflict.updateWhere, conditions...)
+	return s
+}
+
+func buildUpsertClause(s *SqlBuilder) string {
+	conflict := s.onConflict
+	if conflict.doNothing == (conflict.setParams.Len() > 0) {
+		s.err = errors.New("OnConflict needs either DoNothing or DoUpdateSet")
+		return ""
+	}
+	if !conflict.doNothing && len(conflict.columns) == 0 && s.Dialect() != MySql {
+		s.err = errors.New("DoUpdateSet needs conflict columns")
+	}
+	if s.Dialect() == MySql && conflict.doNothing && len(conflict.columns) == 0 {
+		s.err = errors.New("DoNothing needs a conflict column for " + s.Dialect().Name())
+	}
+	if s.Dialect() == MySql && (len(conflict.where) > 0 || len(conflict.updateWhere) > 0) {
+		s.err = errors.New("Conflict conditions are not supported by " + s.Dialect().Name())
+	}
+
+	upsert := Upsert{}
+	for _, column := range conflict.columns {
+		upsert.ConflictColumns = append(upsert.ConflictColumns, s.identifier(column))
+	}
+	upsert.ConflictWhere = renderConditions(s, conflict.where)
+
+	for _, name := range conflict.setParams.Keys() {
+		value, _ := conflict.setParams.Get(name)
+		column := s.identifier(name.(string))
+		if excluded, ok := value.(ExcludedValue); ok {
+			upsert.Assignments = append(upsert.Assignments, column+"="+s.Dialect().ExcludedColumn(s.identifier(excluded.Column)))
+		} else {
+			upsert.Assignments = append(upsert.Assignments, column+"="+s.bind(name.(string), value))
+		}
+	}
+	upsert.UpdateWhere = renderConditions(s, conflict.updateWhere)
+
+	return s.Dialect().UpsertClause(upsert)
+}
+
+func renderConditions(s *SqlBuilder, conditions []Condition) string {
+	sb := StringBuilder{}
+	for i, condition := range conditions {
+		if i > 0 {
+			sb.Write(" AND ")
+		}
+		sb.Write(condition.render(s))
+	}
+	return sb.String()
+}
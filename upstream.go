@@ -0,0 +1,252 @@
+package httptesting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BodyMatcher decides whether a request body satisfies an expectation
+type BodyMatcher func(body []byte) bool
+
+// JsonBody matches bodies equal to the JSON encoding of a value, regardless of formatting and key order
+func JsonBody(value interface{}) BodyMatcher {
+	expected, err := json.Marshal(value)
+	return func(body []byte) bool {
+		return err == nil && equalBodies(string(expected), string(body))
+	}
+}
+
+func BodyContains(s string) BodyMatcher {
+	return func(body []byte) bool {
+		return strings.Contains(string(body), s)
+	}
+}
+
+// Expectation is a call a FakeUpstream expects, and how it should be answered
+type Expectation struct {
+	lock    *sync.Mutex
+	method  string
+	path    string
+	matcher BodyMatcher
+	status  int
+	header  http.Header
+	body    []byte
+	fail    bool
+	delay   time.Duration
+	times   int
+	calls   int
+}
+
+// FakeUpstream stubs a service called by handlers under test. Calls have to match registered expectations,
+// every expectation has to be met by the end of the test
+type FakeUpstream struct {
+	t            testing.TB
+	server       *httptest.Server
+	lock         sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+	// Problems already reported by Verify, by expectation and by number of unexpected calls
+	reported           map[*Expectation]bool
+	reportedUnexpected int
+}
+
+// NewFakeUpstream starts a fake service, it is verified and closed when the test finishes
+func NewFakeUpstream(t testing.TB) *FakeUpstream {
+	u := &FakeUpstream{t: t, expectations: make([]*Expectation, 0), unexpected: make([]string, 0), reported: make(map[*Expectation]bool)}
+	u.server = httptest.NewServer(http.HandlerFunc(u.serve))
+	t.Cleanup(func() {
+		u.Close()
+		u.Verify()
+	})
+	return u
+}
+
+// URL is the base url handlers under test should be configured with
+func (u *FakeUpstream) URL() string {
+	return u.server.URL
+}
+
+// Close stops the server, pending requests are answered first
+func (u *FakeUpstream) Close() {
+	u.server.Close()
+}
+
+// Expect registers a call, path may be a route template like /users/:id. By default the call is answered
+// with an empty 200 response and expected at least once
+func (u *FakeUpstream) Expect(method string, path string) *Expectation {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	e := &Expectation{lock: &u.lock, method: method, path: path, status: http.StatusOK, header: http.Header{}}
+	u.expectations = append(u.expectations, e)
+	return e
+}
+
+// WithBody restricts the expectation to requests with a matching body
+func (e *Expectation) WithBody(matcher BodyMatcher) *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.matcher = matcher
+	return e
+}
+
+// Respond sets the response, strings and byte slices are sent as is, other values as JSON
+func (e *Expectation) Respond(status int, body interface{}) *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.status = status
+	switch b := body.(type) {
+	case nil:
+		e.body = nil
+	case string:
+		e.body = []byte(b)
+	case []byte:
+		e.body = b
+	default:
+		jsonDoc, err := json.Marshal(body)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+		}
+		e.body = jsonDoc
+		if len(e.header.Get("Content-Type")) == 0 {
+			e.header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+	}
+	return e
+}
+
+func (e *Expectation) WithHeader(key string, value string) *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.header.Add(key, value)
+	return e
+}
+
+// Fail drops the connection instead of responding, so the caller gets a transport error
+func (e *Expectation) Fail() *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.fail = true
+	return e
+}
+
+// Delay holds the response back, e.g. to exercise client timeouts
+func (e *Expectation) Delay(delay time.Duration) *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.delay = delay
+	return e
+}
+
+// Times makes the call expected exactly n times, n > 0
+func (e *Expectation) Times(n int) *Expectation {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.times = n
+	return e
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if !strings.EqualFold(e.method, req.Method) {
+		return false
+	}
+	if _, ok := matchRoute(e.path, req.URL.Path); !ok {
+		return false
+	}
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	return e.matcher == nil || e.matcher(body)
+}
+
+func (u *FakeUpstream) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	u.lock.Lock()
+	var expectation *Expectation
+	for _, e := range u.expectations {
+		if e.matches(req, body) {
+			expectation = e
+			break
+		}
+	}
+	if expectation == nil {
+		u.unexpected = append(u.unexpected, req.Method+" "+req.URL.RequestURI())
+		u.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte(`{"Status": "Error", "Error": "Unexpected call"}`))
+		return
+	}
+	expectation.calls++
+	// The response is copied, expectations may be changed while it is sent
+	response := *expectation
+	response.header = expectation.header.Clone()
+	u.lock.Unlock()
+
+	if response.delay > 0 {
+		select {
+		case <-time.After(response.delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if response.fail {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, v := range response.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(response.status)
+	w.Write(response.body)
+}
+
+func (u *FakeUpstream) unreported() []string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	problems := make([]string, 0)
+	for _, e := range u.expectations {
+		if u.reported[e] {
+			continue
+		}
+		switch {
+		case e.times == 0 && e.calls == 0:
+			problems = append(problems, fmt.Sprintf("%s %s was never called", e.method, e.path))
+		case e.times > 0 && e.calls != e.times:
+			problems = append(problems, fmt.Sprintf("%s %s was called %d times, expected %d", e.method, e.path, e.calls, e.times))
+		default:
+			continue
+		}
+		u.reported[e] = true
+	}
+	for _, call := range u.unexpected[u.reportedUnexpected:] {
+		problems = append(problems, fmt.Sprintf("Unexpected call %s", call))
+	}
+	u.reportedUnexpected = len(u.unexpected)
+	return problems
+}
+
+// Verify fails the test for every unmet expectation and unexpected call. It runs on cleanup as well,
+// reporting what happened after an explicit Verify, problems are reported once
+func (u *FakeUpstream) Verify() {
+	u.t.Helper()
+	for _, problem := range u.unreported() {
+		u.t.Errorf("Fake upstream: %s\n", problem)
+	}
+}
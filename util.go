@@ -4,10 +4,16 @@ import (
 	"database/sql"
 )
 
-func CountRows(db *sql.DB, tableName string) (int, error) {
+// CountRows counts the rows of a table, optionally only the ones matching conditions
+func CountRows(db SqlExecutor, tableName string, filter ...Condition) (int, error) {
 	builder := PostgresSqlBuilder{}
-	query, inArgs, _, err := builder.Select(tableName).Returning("count(id)").
-		WhereArgRelationship("id", ">=", 0).Build()
+	builder.Select(tableName).Returning(Count("*", ""))
+	if len(filter) == 0 {
+		builder.All()
+	} else {
+		builder.WhereExpr(filter...)
+	}
+	query, inArgs, _, err := builder.Build()
 	if err != nil {
 		return -1, err
 	}
@@ -20,3 +26,10 @@ func CountRows(db *sql.DB, tableName string) (int, error) {
 
 	return count, nil
 }
+
+// SqlExecutor is implemented by both *sql.DB and *sql.Tx
+type SqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
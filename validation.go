@@ -0,0 +1,85 @@
+package httptesting
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Raw is a SQL fragment written into a statement as it is, e.g. SetArg("updated", Raw("now()")).
+// It must never be built from user input
+type Raw string
+
+var relationships = map[string]bool{
+	"=":         true,
+	"<>":        true,
+	"!=":        true,
+	"<":         true,
+	"<=":        true,
+	">":         true,
+	">=":        true,
+	"LIKE":      true,
+	"NOT LIKE":  true,
+	"ILIKE":     true,
+	"NOT ILIKE": true,
+}
+
+var directionPattern = regexp.MustCompile(`^(?i)(ASC|DESC)( NULLS (FIRST|LAST))?$`)
+
+// expressionPattern matches the aggregates and window counts of the select list, e.g. sum(o.amount) AS total
+var expressionPattern = regexp.MustCompile(`^(?i:count|sum|avg|min|max)\((\*|[A-Za-z_][A-Za-z0-9_$]*(\.([A-Za-z_][A-Za-z0-9_$]*|\*))*)\)( OVER \(\))?( AS [A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// cteNamePattern matches common table expression names with an optional column list, e.g. tree(id, parentid)
+var cteNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\([A-Za-z_][A-Za-z0-9_$]*(, *[A-Za-z_][A-Za-z0-9_$]*)*\))?$`)
+
+// Safe rejects every table name, column, alias and select expression which is not a plain identifier or an aggregate
+// of one, so sort and filter columns coming from users can be passed on. Raw fragments stay allowed. Subqueries
+// built into a safe statement are checked as well
+func (s *SqlBuilder) Safe() *SqlBuilder {
+	s.safe = true
+	return s
+}
+
+func (s *SqlBuilder) safeMode() bool {
+	return s.safe || (s.parent != nil && s.parent.safeMode())
+}
+
+func (s *SqlBuilder) checkIdentifier(name string) {
+	if s.safeMode() && name != "*" && !identifierPattern.MatchString(name) && !expressionPattern.MatchString(name) {
+		s.err = errors.New("Identifier " + name + " is not allowed in safe mode")
+	}
+}
+
+// Word operators are spaced: name LIKE $1
+func (s *SqlBuilder) relationship(relationship string) string {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(relationship), " "))
+	if len(normalized) == 0 {
+		s.err = errors.New("Relationship is not defined")
+		return ""
+	}
+	if !relationships[normalized] {
+		s.err = errors.New("Relationship " + relationship + " is not allowed")
+		return ""
+	}
+	if strings.HasSuffix(normalized, "LIKE") {
+		return " " + normalized + " "
+	}
+	return normalized
+}
+
+// ILIKE is rewritten like ILike() for dialects which don't have it
+func (s *SqlBuilder) compare(left string, relationship string, right string) string {
+	operator := s.relationship(relationship)
+	if strings.HasSuffix(operator, "ILIKE ") && s.Dialect() != Postgres {
+		return "LOWER(" + left + ")" + strings.Replace(operator, "ILIKE", "LIKE", 1) + "LOWER(" + right + ")"
+	}
+	return left + operator + right
+}
+
+func orderDirection(direction string) (string, error) {
+	direction = strings.Join(strings.Fields(direction), " ")
+	if !directionPattern.MatchString(direction) {
+		return "", errors.New("OrderBy direction " + direction + " is not allowed")
+	}
+	return direction, nil
+}